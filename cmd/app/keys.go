@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/config"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/database/postgres"
+	"github.com/Paincake/filmbase/internal/secrets"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+const keysUsage = `usage:
+  filmbase keys list                 list the signing keys
+  filmbase keys generate [ALGORITHM] add a signing key, RS256 or EdDSA, that signs new tokens once every instance loaded it
+  filmbase keys retire KID           stop signing with a key, its tokens stay valid until they expire`
+
+// runKeys manages the keys access tokens are signed with. The configuration
+// is read from CONFIG_PATH and the environment.
+func runKeys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+	cfg := config.MustLoad(nil)
+	repository, err := postgres.New(cfg.Database.Name, cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connecting to database: %s\n", err)
+		return 1
+	}
+	defer repository.Close()
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		keys, err := repository.SigningKeys(time.Time{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tALGORITHM\tCREATED\tSIGNS FROM\tRETIRED")
+		for _, k := range keys {
+			retired := "-"
+			if k.RetiredAt != nil {
+				retired = k.RetiredAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, k.CreatedAt.Format(time.RFC3339), k.NotBefore.Format(time.RFC3339), retired)
+		}
+		w.Flush()
+	case args[0] == "generate" && len(args) <= 2:
+		algorithm := cfg.JWT.Algorithm
+		if len(args) == 2 {
+			algorithm = args[1]
+		}
+		key, err := auth.GenerateSigningKey(algorithm)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		key.NotBefore = key.CreatedAt.Add(keyActivationDelay(cfg.JWT))
+		if key, err = sealSigningKey(key, cfg.JWT); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err = repository.CreateSigningKey(key); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(key.ID)
+		fmt.Fprintf(os.Stderr, "%s signs tokens from %s\n", key.ID, key.NotBefore.Format(time.RFC3339))
+	case args[0] == "retire" && len(args) == 2:
+		err = repository.RetireSigningKey(args[1])
+		if errors.Is(err, database.ErrKeyNotFound) {
+			fmt.Fprintf(os.Stderr, "no active signing key %s\n", args[1])
+			return 1
+		}
+		if errors.Is(err, database.ErrLastSigningKey) {
+			fmt.Fprintf(os.Stderr, "%s is the last active signing key, generate another one first\n", args[1])
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		return 2
+	}
+	return 0
+}
+
+// keyActivationDelay is how long a generated key is published before it signs
+// tokens. Every instance reloads the keys within one refresh interval, the
+// second one leaves room for a slow reload.
+func keyActivationDelay(jwt config.JWT) time.Duration {
+	return 2 * jwt.KeysRefreshInterval
+}
+
+// loadSigningKeys loads the signing keys, including the retired keys whose
+// tokens may not have expired yet. Keys stored unencrypted are encrypted.
+// Unless tokens are signed with the secret key, a key signing right away is
+// generated when there is none, as no instance could sign tokens yet.
+func loadSigningKeys(repository database.FilmbaseRepository, jwt config.JWT) error {
+	if jwt.Algorithm == auth.AlgorithmHS256 {
+		return nil
+	}
+	keys, err := repository.SigningKeys(time.Now().Add(-jwt.AccessTTL))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if !isPlaintextKey(k.PrivateKey) {
+			continue
+		}
+		sealed, err := sealSigningKey(k, jwt)
+		if err != nil {
+			return err
+		}
+		if err = repository.UpdateSigningKey(k.ID, sealed.PrivateKey); err != nil {
+			return fmt.Errorf("encrypting signing key %s: %w", k.ID, err)
+		}
+	}
+	if !slices.ContainsFunc(keys, func(k database.SigningKey) bool { return k.RetiredAt == nil }) {
+		key, err := auth.GenerateSigningKey(jwt.Algorithm)
+		if err != nil {
+			return err
+		}
+		if key, err = sealSigningKey(key, jwt); err != nil {
+			return err
+		}
+		if _, err = repository.CreateFirstSigningKey(key); err != nil {
+			return err
+		}
+	}
+	return reloadSigningKeys(repository, jwt)
+}
+
+func reloadSigningKeys(repository database.FilmbaseRepository, jwt config.JWT) error {
+	keys, err := repository.SigningKeys(time.Now().Add(-jwt.AccessTTL))
+	if err != nil {
+		return err
+	}
+	encryptionKey, err := secrets.ParseKey(jwt.KeysEncryptionKey)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if isPlaintextKey(k.PrivateKey) {
+			continue
+		}
+		if keys[i].PrivateKey, err = secrets.Open(encryptionKey, k.PrivateKey); err != nil {
+			return fmt.Errorf("decrypting signing key %s: %w", k.ID, err)
+		}
+	}
+	return auth.SetSigningKeys(keys)
+}
+
+// sealSigningKey returns key with its private key encrypted with the keys
+// encryption key, so that reading the database is not enough to sign tokens.
+func sealSigningKey(key database.SigningKey, jwt config.JWT) (database.SigningKey, error) {
+	encryptionKey, err := secrets.ParseKey(jwt.KeysEncryptionKey)
+	if err != nil {
+		return key, err
+	}
+	if key.PrivateKey, err = secrets.Seal(encryptionKey, key.PrivateKey); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+// isPlaintextKey reports whether privateKey is a PEM key stored before the
+// signing keys were encrypted.
+func isPlaintextKey(privateKey []byte) bool {
+	return bytes.HasPrefix(privateKey, []byte("-----BEGIN "))
+}
+
+// refreshSigningKeys reloads the signing keys every interval until ctx is done,
+// so that keys generated or retired by the keys command are picked up.
+func refreshSigningKeys(ctx context.Context, repository database.FilmbaseRepository, jwt config.JWT, logger *slog.Logger) {
+	if jwt.Algorithm == auth.AlgorithmHS256 {
+		return
+	}
+	ticker := time.NewTicker(jwt.KeysRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := reloadSigningKeys(repository, jwt); err != nil {
+			logger.Error(fmt.Sprintf("Error reloading signing keys: %s", err))
+		}
+	}
+}
@@ -1,45 +1,277 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/cache"
+	"github.com/Paincake/filmbase/internal/certs"
 	"github.com/Paincake/filmbase/internal/config"
 	"github.com/Paincake/filmbase/internal/database"
 	"github.com/Paincake/filmbase/internal/database/postgres"
 	"github.com/Paincake/filmbase/internal/handler"
+	"github.com/Paincake/filmbase/internal/lockout"
+	"github.com/Paincake/filmbase/internal/mail"
+	"github.com/Paincake/filmbase/internal/metrics"
 	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/Paincake/filmbase/internal/problem"
+	"github.com/Paincake/filmbase/internal/ratelimit"
+	"github.com/Paincake/filmbase/internal/secrets"
 	"github.com/Paincake/filmbase/internal/server"
+	"github.com/Paincake/filmbase/internal/tracing"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	cfg, srv := config.MustLoad()
-	si := server.BasicServer{}
-	repository, err := postgres.New(cfg.Name, cfg.User, cfg.Password, cfg.Host, cfg.Port)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "secrets":
+			os.Exit(runSecrets(os.Args[2:]))
+		case "keys":
+			os.Exit(runKeys(os.Args[2:]))
+		case "create-admin":
+			os.Exit(runCreateAdmin(os.Args[2:]))
+		}
+	}
+	cfg := config.MustLoad(os.Args[1:])
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(cfg.Log.Level))
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+	srv := cfg.HTTPServer
+	provider, err := cfg.SecretProvider()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error configuring secrets: %s", err))
+		os.Exit(1)
+	}
+	secretStore := secrets.NewStore(provider, cfg.SecretValues())
+	auth.SetSecretKey(secretStore.Get(config.JWTSecretEnv))
+	auth.Configure(auth.Options{
+		Algorithm:  cfg.JWT.Algorithm,
+		Issuer:     cfg.JWT.Issuer,
+		Audience:   cfg.JWT.Audience,
+		AccessTTL:  cfg.JWT.AccessTTL,
+		RefreshTTL: cfg.JWT.RefreshTTL,
+	})
+	secretStore.OnChange(func() {
+		auth.SetSecretKey(secretStore.Get(config.JWTSecretEnv))
+		logger.Info("Secrets reloaded")
+	})
+	auth.ConfigurePasswords(cfg.Passwords.HashOptions())
+	passwords, err := cfg.Passwords.Policy()
 	if err != nil {
-		logger.Error(fmt.Sprintf("Error loading config file:%s", err))
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
+	si := server.BasicServer{DefaultRole: cfg.Authz.DefaultRole, Roles: cfg.Authz.RoleNames(), Passwords: passwords, MFARoles: cfg.Authz.MFARoles}
+	repository, err := postgres.New(cfg.Database.Name, cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error connecting to database: %s", err))
+		os.Exit(1)
+	}
+	repository.SetPasswordFunc(func() string { return secretStore.Get(config.DBPasswordEnv) })
+	repository.ConfigurePool(cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns, cfg.Database.ConnMaxLifetime, cfg.Database.ConnMaxIdleTime)
 	logger.Debug("Config loaded")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error setting up tracing: %s", err))
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+	if err = repository.Migrate(); err != nil {
+		logger.Error(fmt.Sprintf("Error applying migrations: %s", err))
+		os.Exit(1)
+	}
+	if err = loadSigningKeys(repository, cfg.JWT); err != nil {
+		logger.Error(fmt.Sprintf("Error loading signing keys: %s", err))
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	reloadSecrets := make(chan os.Signal, 1)
+	signal.Notify(reloadSecrets, syscall.SIGHUP)
+	go secretStore.Watch(ctx, cfg.Secrets.RefreshInterval, reloadSecrets, func(err error) {
+		logger.Error(fmt.Sprintf("Error reloading secrets: %s", err))
+	})
+
+	var repo database.FilmbaseRepository = repository
+	if cfg.Features.Metrics {
+		metrics.RegisterDBStats(repository.DB(), cfg.Database.Name)
+		repo = metrics.NewRepository(repo)
+	}
+	if cfg.Features.Cache {
+		cachedRepository := cache.New(repo, cfg.Cache.Size, cfg.Cache.TTL)
+		listener := repository.NewListener(database.ChangesChannel, logger)
+		go listener.Listen(ctx, cachedRepository.Invalidate, cachedRepository.Purge)
+		repo = cachedRepository
+	}
 
-	middlewares := []middleware.MiddlewareFunc{middleware.VerifyJWT}
+	go prune(ctx, "expired tokens", repo.PruneTokens, cfg.JWT.PruneInterval, logger)
+	if cfg.Lockout.Enabled {
+		var store lockout.Store = repo
+		if cfg.Lockout.Store == "memory" {
+			store = lockout.NewMemory()
+		}
+		si.Lockout = lockout.New(store, cfg.Lockout.Options())
+		go prune(ctx, "forgotten login failures", si.Lockout.Prune, cfg.Lockout.PruneInterval, logger)
+	}
+	if cfg.Mail.Transport != "none" {
+		si.AccountMail = &server.AccountMail{
+			ResetURL:  cfg.Mail.ResetURL,
+			VerifyURL: cfg.Mail.VerifyURL,
+			ResetTTL:  cfg.Mail.ResetTTL,
+			VerifyTTL: cfg.Mail.VerifyTTL,
+		}
+		worker := mail.NewWorker(repo, newMailer(cfg.Mail, secretStore, logger), cfg.Mail.WorkerOptions(), logger)
+		go worker.Run(ctx, cfg.Mail.PollInterval)
+		go prune(ctx, "sent mail", func() (int64, error) {
+			return repo.PruneMail(time.Now().Add(-cfg.Mail.Retention))
+		}, cfg.Mail.PruneInterval, logger)
+	}
+	go refreshSigningKeys(ctx, repo, cfg.JWT, logger)
+
+	// Middlewares wrap the handler in order, the last one runs first.
+	authenticators := []middleware.Authenticator{middleware.JWTAuthenticator(repo), middleware.APIKeyAuthenticator(repo)}
+	if cfg.OIDC.Issuer != "" {
+		provider := auth.NewOIDCProvider(cfg.OIDC.Issuer, cfg.OIDC.Audience)
+		authenticators = append(authenticators, middleware.OIDCAuthenticator(provider, cfg.OIDC.ClaimMapping(), repo, repo))
+	}
+	middlewares := []middleware.MiddlewareFunc{middleware.Authorize(policy.Parse(cfg.Authz.Roles)), middleware.Authenticate(authenticators...)}
+	var rateLimit middleware.MiddlewareFunc
+	if cfg.RateLimit.Enabled {
+		limiter := ratelimit.New(ratelimit.NewMemory(), cfg.RateLimit.Options())
+		clients := ratelimit.New(ratelimit.NewMemory(), cfg.RateLimit.ClientOptions())
+		go prune(ctx, "full rate limit buckets", limiter.Prune, cfg.RateLimit.PruneInterval, logger)
+		go prune(ctx, "full client rate limit buckets", clients.Prune, cfg.RateLimit.PruneInterval, logger)
+		// Users are only known once authenticated, clients are limited before
+		// too so that requests failing authentication are limited as well.
+		rateLimit = middleware.RateLimit(limiter)
+		middlewares = []middleware.MiddlewareFunc{middlewares[0], rateLimit, middlewares[1], middleware.RateLimit(clients)}
+	}
+	if len(srv.TLSClientRoles) > 0 {
+		middlewares = append(middlewares, middleware.ClientCert(srv.TLSClientRoles))
+	}
 
 	opts := HandlerOptions{
 		BaseRouter:       *http.NewServeMux(),
 		Middlewares:      middlewares,
+		RateLimit:        rateLimit,
 		ErrorHandlerFunc: nil,
+		Features:         cfg.Features,
+	}
+
+	router := HandlerWithOptions(si, &opts, repo, logger)
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		router = middleware.CORS(cfg.CORS.AllowedOrigins, cfg.CORS.AllowedMethods, cfg.CORS.AllowedHeaders, int(cfg.CORS.MaxAge.Seconds()))(router)
+	}
+	httpServer := &http.Server{
+		Addr:           srv.Address,
+		Handler:        router,
+		ReadTimeout:    srv.ReadTimeout,
+		WriteTimeout:   srv.WriteTimeout,
+		IdleTimeout:    srv.IdleTimeout,
+		MaxHeaderBytes: srv.MaxHeaderBytes,
+	}
+
+	useTLS := srv.TLSCertFile != "" && srv.TLSKeyFile != ""
+	if useTLS {
+		reloader, err := certs.NewReloader(srv.TLSCertFile, srv.TLSKeyFile, logger)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error loading TLS certificate: %s", err))
+			os.Exit(1)
+		}
+		go reloader.Watch(ctx, srv.TLSReloadInterval)
+		httpServer.TLSConfig, err = certs.ServerConfig(reloader, srv.TLSClientCAFile)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error configuring TLS: %s", err))
+			os.Exit(1)
+		}
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info(fmt.Sprintf("Starting server at address %s, TLS: %t", srv.Address, useTLS))
+		if useTLS {
+			serverErr <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			serverErr <- httpServer.ListenAndServe()
+		}
+	}()
+
+	exitCode := 0
+	select {
+	case err = <-serverErr:
+		logger.Error(fmt.Sprintf("Server stopped: %s", err))
+		exitCode = 1
+	case <-ctx.Done():
+		logger.Info(fmt.Sprintf("Shutting down, draining requests for up to %s", srv.ShutdownTimeout))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), srv.ShutdownTimeout)
+		defer cancel()
+		if err = httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error(fmt.Sprintf("Error draining requests: %s", err))
+		}
+	}
+
+	if err = repository.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Error closing database: %s", err))
+	}
+	logger.Info("Server stopped")
+	if exitCode != 0 {
+		shutdownTracing(context.Background())
+		os.Exit(exitCode)
+	}
+}
+
+// newMailer returns the mailer of the configured transport.
+func newMailer(cfg config.Mail, secretStore *secrets.Store, logger *slog.Logger) mail.Mailer {
+	switch cfg.Transport {
+	case "smtp":
+		return mail.SMTP{
+			Address:  cfg.SMTPAddress,
+			Username: cfg.SMTPUsername,
+			Password: func() string { return secretStore.Get(config.SMTPPasswordEnv) },
+			From:     cfg.From,
+		}
+	case "file":
+		return mail.NewFile(cfg.File, cfg.From)
+	default:
+		return mail.Log{Logger: logger}
 	}
+}
 
-	router := HandlerWithOptions(si, &opts, repository, logger)
-	logger.Info(fmt.Sprintf("Starting server at address %s", srv.Address))
-	err = http.ListenAndServe("localhost:8080", router)
+// prune calls fn every interval until ctx is done, fn deletes what has expired,
+// e.g. tokens.
+func prune(ctx context.Context, what string, fn func() (int64, error), interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pruned, err := fn()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error pruning %s: %s", what, err))
+			continue
+		}
+		logger.Debug(fmt.Sprintf("Pruned %d %s", pruned, what))
+	}
 }
 
 type HandlerOptions struct {
-	BaseRouter       http.ServeMux
-	Middlewares      []middleware.MiddlewareFunc
+	BaseRouter  http.ServeMux
+	Middlewares []middleware.MiddlewareFunc
+	// RateLimit limits the operations that are not authenticated, which do
+	// not run Middlewares. nil limits none.
+	RateLimit        middleware.MiddlewareFunc
 	ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
+	Features         config.Features
 }
 
 // HandlerWithOptions creates http.Handler with additional options
@@ -48,7 +280,7 @@ func HandlerWithOptions(si server.ServerInterface, options *HandlerOptions, repo
 
 	if options.ErrorHandlerFunc == nil {
 		options.ErrorHandlerFunc = func(w http.ResponseWriter, r *http.Request, err error) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, http.StatusBadRequest, err)
 		}
 	}
 	wrapper := handler.ServerInterfaceWrapper{
@@ -59,18 +291,64 @@ func HandlerWithOptions(si server.ServerInterface, options *HandlerOptions, repo
 		ErrorHandlerFunc:   options.ErrorHandlerFunc,
 	}
 
-	r.HandleFunc("POST "+"/actor", wrapper.CreateActor)
-	r.HandleFunc("GET "+"/actor/films", wrapper.GetActorFilms)
-	r.HandleFunc("PUT "+"/actor", wrapper.PutActor)
-	r.HandleFunc("DELETE "+"/actor/{actorId}", wrapper.DeleteActor)
-	r.HandleFunc("POST "+"/actor/{actorId}/{filmId}", wrapper.PostActorFilm)
-	r.HandleFunc("GET "+"/film", wrapper.GetFilm)
-	r.HandleFunc("POST "+"/film", wrapper.CreateFilm)
-	r.HandleFunc("PUT "+"/film", wrapper.ChangeFilm)
-	r.HandleFunc("GET "+"/film/search", wrapper.GetFilmSearch)
-	r.HandleFunc("DELETE "+"/film/{filmId}", wrapper.DeleteFilm)
-	r.HandleFunc("POST "+"/login", wrapper.Login)
-	r.HandleFunc("POST "+"/sign", wrapper.Signup)
+	handle := func(method, route string, h http.HandlerFunc) {
+		handler := middleware.RequestLogger(logger, route)(h)
+		if options.Features.Metrics {
+			handler = middleware.Metrics(route)(handler)
+		}
+		r.Handle(method+" "+route, handler)
+	}
+	// anonymous registers an operation that is not authenticated.
+	anonymous := func(method, route string, h http.HandlerFunc) {
+		if options.RateLimit != nil {
+			h = options.RateLimit(h).ServeHTTP
+		}
+		handle(method, route, h)
+	}
+
+	handle("POST", "/actor", wrapper.CreateActor)
+	handle("GET", "/actor/films", wrapper.GetActorFilms)
+	handle("PUT", "/actor", wrapper.PutActor)
+	handle("DELETE", "/actor/{actorId}", wrapper.DeleteActor)
+	handle("POST", "/actor/{actorId}/{filmId}", wrapper.PostActorFilm)
+	handle("GET", "/film", wrapper.GetFilm)
+	handle("POST", "/film", wrapper.CreateFilm)
+	handle("PUT", "/film", wrapper.ChangeFilm)
+	handle("GET", "/film/search", wrapper.GetFilmSearch)
+	handle("DELETE", "/film/{filmId}", wrapper.DeleteFilm)
+	anonymous("POST", "/login", wrapper.Login)
+	anonymous("POST", "/login/mfa", wrapper.LoginMFA)
+	anonymous("POST", "/login/mfa/enroll", wrapper.EnrollLoginTOTP)
+	anonymous("POST", "/token/refresh", wrapper.RefreshToken)
+	handle("POST", "/logout", wrapper.Logout)
+	handle("POST", "/mfa/totp", wrapper.BeginTOTP)
+	handle("POST", "/mfa/totp/confirm", wrapper.ConfirmTOTP)
+	handle("DELETE", "/mfa/totp", wrapper.DeleteTOTP)
+	handle("POST", "/mfa/recovery-codes", wrapper.RegenerateRecoveryCodes)
+	handle("GET", "/admin/users", wrapper.ListUsers)
+	handle("PUT", "/admin/users/{username}/role", wrapper.SetUserRole)
+	handle("POST", "/admin/users/{username}/disable", wrapper.DisableUser)
+	handle("POST", "/admin/users/{username}/enable", wrapper.EnableUser)
+	handle("POST", "/admin/users/{username}/unlock", wrapper.UnlockUser)
+	handle("DELETE", "/admin/users/{username}", wrapper.DeleteUser)
+	handle("POST", "/admin/users/{username}/revoke", wrapper.RevokeUserTokens)
+	handle("POST", "/admin/api-keys", wrapper.CreateAPIKey)
+	handle("GET", "/admin/api-keys", wrapper.ListAPIKeys)
+	handle("DELETE", "/admin/api-keys/{prefix}", wrapper.DeleteAPIKey)
+	if options.Features.Signup {
+		anonymous("POST", "/sign", wrapper.Signup)
+	}
+	anonymous("POST", "/password/forgot", wrapper.ForgotPassword)
+	anonymous("POST", "/password/reset", wrapper.ResetPassword)
+	anonymous("POST", "/email/verify/request", wrapper.RequestEmailVerification)
+	anonymous("POST", "/email/verify", wrapper.VerifyEmail)
+	handle("GET", "/.well-known/jwks.json", wrapper.JWKS)
+	handle("GET", "/healthz", wrapper.Healthz)
+	handle("GET", "/readyz", wrapper.Readyz)
+
+	if options.Features.Metrics {
+		r.Handle("GET /metrics", metrics.Handler())
+	}
 
 	return r
 }
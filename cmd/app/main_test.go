@@ -2,60 +2,43 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"github.com/Paincake/filmbase/internal/auth"
 	"github.com/Paincake/filmbase/internal/config"
 	"github.com/Paincake/filmbase/internal/database"
 	"github.com/Paincake/filmbase/internal/database/postgres"
 	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/Paincake/filmbase/internal/lockout"
+	"github.com/Paincake/filmbase/internal/mail"
 	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/Paincake/filmbase/internal/problem"
 	"github.com/Paincake/filmbase/internal/server"
-	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 )
 
 const (
-	FilmTableDDl = `
-	CREATE TABLE IF NOT EXISTS film (
-		id serial PRIMARY KEY,
-		name varchar CHECK(char_length(name) > 1),
-		description varchar CHECK ( char_length(name) > 1 AND char_length(name) < 1000 ),
-		rating smallint CHECK (rating IN (0,1,2,3,4,5,6,7,8,9,10)),
-		release_date date
-	)
-`
-	ActorTableDDl = `
-	CREATE TABLE IF NOT EXISTS actor (
-		id serial PRIMARY KEY,
-		name varchar CHECK(char_length(name) > 1),
-		gender varchar CHECK(gender IN ('male', 'female')),
-		birthdate date
-	)
-`
-	ActorFilmTableDDl = `
-	CREATE TABLE IF NOT EXISTS actor_films (
-		actorid int REFERENCES actor(id),
-		filmid int REFERENCES film(id),
-		PRIMARY KEY (actorid, filmid)
-	)
-`
-	UserTableDDl = `
-	CREATE TABLE IF NOT EXISTS api_users (
-		username varchar PRIMARY KEY,
-		password varchar,
-		role varchar
-	)
-`
 	ClearTables = `
 	TRUNCATE TABLE actor;
 	TRUNCATE TABLE film;
 	TRUNCATE TABLE actor_films;
-	TRUNCATE TABLE api_users;
+	TRUNCATE TABLE api_users, refresh_tokens, user_revocations, user_tokens, totp, recovery_codes;
+	TRUNCATE TABLE outbox;
+	TRUNCATE TABLE revoked_tokens;
+	TRUNCATE TABLE api_keys;
+	TRUNCATE TABLE login_attempts, failed_logins;
 	ALTER SEQUENCE actor_id_seq RESTART WITH 1;
 	ALTER SEQUENCE film_id_seq RESTART WITH 1
 `
@@ -63,6 +46,16 @@ const (
 
 var router http.Handler
 var db database.FilmbaseRepository
+var outbox *mail.Worker
+var mails mailbox
+
+// mailbox keeps the mail sent from the outbox.
+type mailbox []mail.Message
+
+func (m *mailbox) Send(_ context.Context, message mail.Message) error {
+	*m = append(*m, message)
+	return nil
+}
 
 func TestMain(m *testing.M) {
 	setup()
@@ -95,9 +88,29 @@ func TestCreateActor_ShouldGet422(t *testing.T) {
 	router.ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
 }
+func TestCreateActor_ShouldReportEveryInvalidField(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	body := `{"name":"J","gender":"other","birthdate":"01.01.2001"}`
+	req := httptest.NewRequest("POST", "/actor", bytes.NewBufferString(body))
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	var details problem.Details
+	if err := json.NewDecoder(recorder.Body).Decode(&details); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, problem.TypeValidation, details.Type)
+	assert.Equal(t, []database.FieldError{
+		{Field: "birthdate", Message: "must be a date of the form YYYY-MM-DD"},
+		{Field: "gender", Message: "must be one of male, female"},
+		{Field: "name", Message: "must be at least 2 characters long"},
+	}, details.Errors)
+}
+
 func TestCreateActor_ShouldGet200(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	body, _ := json.Marshal(dto.Actor{Name: "a", Gender: "male", Birthdate: "2001-01-01"})
+	body, _ := json.Marshal(dto.Actor{Name: "John Shishkin", Gender: "male", Birthdate: dto.NewDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))})
 	req := httptest.NewRequest("POST", "/actor", bytes.NewBuffer(body))
 	token, _ := auth.CreateJWT("test", "admin")
 	req.Header.Set("Token", token)
@@ -131,7 +144,7 @@ func TestPutActor_ShouldGet422(t *testing.T) {
 }
 func TestPutActor_ShouldGet200(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	body, _ := json.Marshal(dto.Actor{Name: "a", Gender: "male", Birthdate: "2001-01-01"})
+	body, _ := json.Marshal(dto.Actor{Name: "John Shishkin", Gender: "male", Birthdate: dto.NewDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))})
 	req := httptest.NewRequest("PUT", "/actor", bytes.NewBuffer(body))
 	token, _ := auth.CreateJWT("test", "admin")
 	req.Header.Set("Token", token)
@@ -156,11 +169,11 @@ func TestGetActorFilms_ShouldGet403(t *testing.T) {
 }
 
 func TestGetActorFilms_ShouldGet200(t *testing.T) {
-	_, err := db.PostActor(database.Actor{Id: 1, Name: "TEST", Gender: "male", Birthdate: "2001-01-01"})
+	_, err := db.PostActor(database.Actor{Id: 1, Name: "TEST", Gender: "male", Birthdate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)})
 	if err != nil {
 		t.Fail()
 	}
-	_, err = db.PostFilm(database.Film{Id: 1, Name: "TEST", Description: "TEST", ReleaseDate: "2001-01-01", Rating: 0})
+	_, err = db.PostFilm(database.Film{Id: 1, Name: "TEST", Description: "TEST", ReleaseDate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Rating: 0})
 	if err != nil {
 		t.Errorf("test failed: %s", err)
 	}
@@ -206,7 +219,7 @@ func TestDeleteActor_ShouldGet403(t *testing.T) {
 }
 
 func TestDeleteActor_ShouldGet200(t *testing.T) {
-	_, err := db.PostActor(database.Actor{Id: 10, Name: "TESTDELETE", Gender: "female", Birthdate: "2001-01-01"})
+	_, err := db.PostActor(database.Actor{Id: 10, Name: "TESTDELETE", Gender: "female", Birthdate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)})
 	if err != nil {
 		t.Fail()
 	}
@@ -238,11 +251,11 @@ func TestPostActorFilms_ShouldGet403(t *testing.T) {
 }
 
 func TestPostActorFilms_ShouldGet200(t *testing.T) {
-	_, err := db.PostActor(database.Actor{Id: 20, Name: "TEST", Gender: "male", Birthdate: "2001-01-01"})
+	_, err := db.PostActor(database.Actor{Id: 20, Name: "TEST", Gender: "male", Birthdate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)})
 	if err != nil {
 		t.Fail()
 	}
-	_, err = db.PostFilm(database.Film{Id: 20, Name: "TEST", Description: "TEST", ReleaseDate: "2001-01-01", Rating: 0})
+	_, err = db.PostFilm(database.Film{Id: 20, Name: "TEST", Description: "TEST", ReleaseDate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Rating: 0})
 	if err != nil {
 		t.Errorf("test failed: %s", err)
 	}
@@ -286,7 +299,7 @@ func TestGetFilm_ShouldGet403(t *testing.T) {
 }
 
 func TestGetFilm_ShouldGet200(t *testing.T) {
-	_, err := db.PostFilm(database.Film{Id: 30, Name: "TEST", Description: "TEST", ReleaseDate: "2001-01-01", Rating: 0})
+	_, err := db.PostFilm(database.Film{Id: 30, Name: "TEST", Description: "TEST", ReleaseDate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Rating: 0})
 	if err != nil {
 		t.Errorf("test failed: %s", err)
 	}
@@ -335,7 +348,7 @@ func TestCreateFilm_ShouldGet422(t *testing.T) {
 
 func TestCreateFilm_ShouldGet200(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	body, _ := json.Marshal(dto.Film{Name: "a", Description: "male", ReleaseDate: "2001-01-01", Rating: 1})
+	body, _ := json.Marshal(dto.Film{Name: "Bladerunner 2049", Description: "male", ReleaseDate: dto.NewDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)), Rating: 1})
 	req := httptest.NewRequest("POST", "/film", bytes.NewBuffer(body))
 	token, _ := auth.CreateJWT("test", "admin")
 	req.Header.Set("Token", token)
@@ -370,7 +383,7 @@ func TestPutFilm_ShouldGet422(t *testing.T) {
 
 func TestPutFilm_ShouldGet200(t *testing.T) {
 	recorder := httptest.NewRecorder()
-	body, _ := json.Marshal(dto.Film{Name: "a", Description: "male", ReleaseDate: "2001-01-01", Rating: 1})
+	body, _ := json.Marshal(dto.Film{Name: "Bladerunner 2049", Description: "male", ReleaseDate: dto.NewDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)), Rating: 1})
 	req := httptest.NewRequest("POST", "/film", bytes.NewBuffer(body))
 	token, _ := auth.CreateJWT("test", "admin")
 	req.Header.Set("Token", token)
@@ -394,7 +407,7 @@ func TestDeleteFilm_ShouldGet403(t *testing.T) {
 }
 
 func TestDeleteFilm_ShouldGet200(t *testing.T) {
-	_, err := db.PostFilm(database.Film{Id: 40, Name: "TEST", Description: "TEST", ReleaseDate: "2001-01-01", Rating: 0})
+	_, err := db.PostFilm(database.Film{Id: 40, Name: "TEST", Description: "TEST", ReleaseDate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Rating: 0})
 	if err != nil {
 		t.Errorf("test failed: %s", err)
 	}
@@ -427,11 +440,11 @@ func TestGetFilmSearch_ShouldGet403(t *testing.T) {
 }
 
 func TestGetFilmSearch_ShouldGet200(t *testing.T) {
-	_, err := db.PostActor(database.Actor{Id: 100, Name: "TEST", Gender: "male", Birthdate: "2001-01-01"})
+	_, err := db.PostActor(database.Actor{Id: 100, Name: "TEST", Gender: "male", Birthdate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)})
 	if err != nil {
 		t.Fail()
 	}
-	_, err = db.PostFilm(database.Film{Id: 100, Name: "TEST", Description: "TEST", ReleaseDate: "2001-01-01", Rating: 0})
+	_, err = db.PostFilm(database.Film{Id: 100, Name: "TEST", Description: "TEST", ReleaseDate: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Rating: 0})
 	if err != nil {
 		t.Errorf("test failed: %s", err)
 	}
@@ -464,6 +477,573 @@ func TestGetFilmSearch_ShouldGet200(t *testing.T) {
 	assert.Equal(t, http.StatusOK, recorder.Code)
 }
 
+func TestHealthz_ShouldGet200(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestReadyz_ShouldGet200(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(recorder, req)
+
+	var health dto.Health
+	err := json.NewDecoder(recorder.Body).Decode(&health)
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, server.StatusUp, health.Checks["database"].Status)
+	assert.Equal(t, server.StatusUp, health.Checks["migrations"].Status)
+}
+
+func TestJWKS_ShouldGet200(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(recorder, req)
+
+	var jwks dto.JWKS
+	err := json.NewDecoder(recorder.Body).Decode(&jwks)
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotNil(t, jwks.Keys)
+}
+
+func TestMetrics_ShouldGet200(t *testing.T) {
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `filmbase_http_requests_total{code="200",method="GET",route="/healthz"}`)
+}
+
+func refresh(refreshToken string) (*httptest.ResponseRecorder, dto.Token) {
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody dto.Token }
+	_ = json.NewDecoder(recorder.Body).Decode(&response)
+	return recorder, response.ResponseBody
+}
+
+func TestRefreshToken_ShouldRotate(t *testing.T) {
+	refreshToken, hash, _ := auth.NewRefreshToken()
+	err := db.CreateRefreshToken(database.RefreshToken{Hash: hash, Family: uuid.NewString(), Username: "test", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+
+	recorder, token := refresh(refreshToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, refreshToken, token.RefreshToken)
+	claims, err := auth.ParseJWT(token.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", claims["role"])
+
+	recorder, _ = refresh(token.RefreshToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestRefreshToken_ReuseShouldRevokeFamily(t *testing.T) {
+	refreshToken, hash, _ := auth.NewRefreshToken()
+	err := db.CreateRefreshToken(database.RefreshToken{Hash: hash, Family: uuid.NewString(), Username: "test", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	recorder, token := refresh(refreshToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder, _ = refresh(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	recorder, _ = refresh(token.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestRefreshToken_ShouldRejectDisabledUser(t *testing.T) {
+	db.RunMigrations(`INSERT INTO api_users VALUES('disabled-refresh', 'disabled-refresh', 'user')`)
+	if err := db.SetUserDisabled("disabled-refresh", true); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	// Stored after the tokens of the user were revoked, as by a racing refresh.
+	refreshToken, hash, _ := auth.NewRefreshToken()
+	err := db.CreateRefreshToken(database.RefreshToken{Hash: hash, Family: uuid.NewString(), Username: "disabled-refresh", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+
+	recorder, _ := refresh(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestRefreshToken_ShouldGet401(t *testing.T) {
+	recorder, _ := refresh("unknown")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestLogout_ShouldRevokeToken(t *testing.T) {
+	token, _ := auth.CreateJWT("test", "admin")
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestRevokeUserTokens_ShouldAcceptTokenIssuedAfterwards(t *testing.T) {
+	db.RunMigrations(`INSERT INTO api_users VALUES('relogin', 'relogin', 'user')`)
+	if err := db.RevokeUserTokens("relogin"); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	// Issued within the second of the revocation, as on a login right after it.
+	token, _ := auth.CreateJWT("relogin", "user")
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestRevokeUserTokens_ShouldGet403(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/admin/users/test/revoke", nil)
+	token, _ := auth.CreateJWT("test", "asdasdasdasd")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
+func TestRevokeUserTokens_ShouldGet404(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/admin/users/nobody/revoke", nil)
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestSignup_ShouldAssignDefaultRole(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.User{Username: "signed-up", Password: "password"})
+	req := httptest.NewRequest("POST", "/sign", bytes.NewBuffer(body))
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/admin/users", nil)
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody []dto.UserInfo }
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, response.ResponseBody, dto.UserInfo{Username: "signed-up", Role: "user", Provider: database.LocalProvider})
+}
+
+func TestSignup_ShouldEnforcePasswordPolicy(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.User{Username: "weak", Password: "weak"})
+	req := httptest.NewRequest("POST", "/sign", bytes.NewBuffer(body))
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "must not contain the username")
+}
+
+func TestSignup_ShouldGet409AsProblemDetails(t *testing.T) {
+	assert.Equal(t, http.StatusCreated, post("/sign", dto.User{Username: "taken", Password: "password"}).Code)
+	recorder := post("/sign", dto.User{Username: "taken", Password: "password"})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, problem.ContentType, recorder.Header().Get("Content-Type"))
+	var details problem.Details
+	if err := json.NewDecoder(recorder.Body).Decode(&details); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, problem.TypeConflict, details.Type)
+	assert.Equal(t, "user already exists", details.Detail)
+}
+
+func TestLogin_ShouldRehashOutdatedPassword(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err := db.Signup("outdated", string(hash), "user", ""); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "198.51.100.8:1234"
+	req.SetBasicAuth("outdated", "password")
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	user, err := db.UserCredentials("outdated")
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	ok, rehash, err := auth.VerifyPassword(user.Password, "password")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	assert.NotEqual(t, string(hash), user.Password)
+}
+
+// mailedToken sends the queued mail and returns the token of the last mail to email.
+func mailedToken(t *testing.T, email string) string {
+	if _, err := outbox.Flush(context.Background()); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	for i := len(mails) - 1; i >= 0; i-- {
+		if mails[i].To == email {
+			match := regexp.MustCompile(`token=([\w-]+)`).FindStringSubmatch(mails[i].Body)
+			if match == nil {
+				t.Fatalf("test failed: no token in %q", mails[i].Body)
+			}
+			return match[1]
+		}
+	}
+	t.Fatalf("test failed: no mail to %s", email)
+	return ""
+}
+
+func post(path string, body any) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	b, _ := json.Marshal(body)
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", path, bytes.NewBuffer(b)))
+	return recorder
+}
+
+func TestResetPassword_ShouldAcceptMailedTokenOnce(t *testing.T) {
+	user := dto.User{Username: "forgetful", Password: "first-password", Email: "Forgetful@Example.com"}
+	assert.Equal(t, http.StatusCreated, post("/sign", user).Code)
+	assert.Equal(t, http.StatusAccepted, post("/password/forgot", dto.EmailRequest{Email: "nobody@example.com"}).Code)
+	assert.Equal(t, http.StatusAccepted, post("/password/forgot", dto.EmailRequest{Email: "forgetful@example.com"}).Code)
+	token := mailedToken(t, "forgetful@example.com")
+
+	reset := dto.PasswordReset{Token: token, Password: "forgetful"}
+	assert.Equal(t, http.StatusUnprocessableEntity, post("/password/reset", reset).Code)
+	reset.Password = "second-password"
+	assert.Equal(t, http.StatusOK, post("/password/reset", reset).Code)
+	assert.Equal(t, http.StatusBadRequest, post("/password/reset", reset).Code)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "198.51.100.9:1234"
+	req.SetBasicAuth("forgetful", "second-password")
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestVerifyEmail_ShouldVerifyMailedEmail(t *testing.T) {
+	user := dto.User{Username: "verified", Password: "password", Email: "verified@example.com"}
+	assert.Equal(t, http.StatusCreated, post("/sign", user).Code)
+	token := mailedToken(t, "verified@example.com")
+	assert.Equal(t, http.StatusBadRequest, post("/email/verify", dto.EmailVerification{Token: "forged"}).Code)
+	assert.Equal(t, http.StatusOK, post("/email/verify", dto.EmailVerification{Token: token}).Code)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	adminToken, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", adminToken)
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody []dto.UserInfo }
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Contains(t, response.ResponseBody, dto.UserInfo{
+		Username:      "verified",
+		Role:          "user",
+		Provider:      database.LocalProvider,
+		Email:         "verified@example.com",
+		EmailVerified: true,
+	})
+}
+
+func TestDisableUser_ShouldRejectTheirTokens(t *testing.T) {
+	db.RunMigrations(`INSERT INTO api_users VALUES('disabled', 'disabled', 'user')`)
+	userToken, _ := auth.CreateJWT("disabled", "user")
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/admin/users/disabled/disable", nil)
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", userToken)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestSetUserRole_ShouldRejectProvisionedUser(t *testing.T) {
+	db.RunMigrations(`INSERT INTO api_users (username, role, provider) VALUES('provisioned', 'user', 'https://idp.example.com')`)
+
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.Role{Role: "admin"})
+	req := httptest.NewRequest("PUT", "/admin/users/provisioned/role", bytes.NewBuffer(body))
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestDeleteUser_ShouldNotDeleteThemselves(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/admin/users/test", nil)
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestAPIKey_ShouldAuthenticateWithinItsScopes(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.APIKeyRequest{Name: "batch", Role: "admin", Scopes: []string{"read"}})
+	req := httptest.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(body))
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody dto.CreatedAPIKey }
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	key := response.ResponseBody.Key
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/film/1?filmId=1", nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "/admin/api-keys/"+response.ResponseBody.Prefix, nil)
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set(middleware.APIKeyHeader, key)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestAPIKey_ShouldNotActAsUser(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	body, _ := json.Marshal(dto.APIKeyRequest{Name: "test", Role: "admin"})
+	req := httptest.NewRequest("POST", "/admin/api-keys", bytes.NewBuffer(body))
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody dto.CreatedAPIKey }
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+
+	for _, path := range []string{"/logout", "/mfa/totp", "/mfa/recovery-codes"} {
+		recorder = httptest.NewRecorder()
+		req = httptest.NewRequest("POST", path, bytes.NewBufferString(`{"code":"123456"}`))
+		req.Header.Set(middleware.APIKeyHeader, response.ResponseBody.Key)
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusForbidden, recorder.Code, path)
+	}
+}
+
+func TestLogin_ShouldAcceptBasicAndJSONCredentials(t *testing.T) {
+	hash, _ := auth.HashPassword("pass:word")
+	if err := db.Signup("colon", hash, "user", ""); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.SetBasicAuth("colon", "pass:word")
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	body, _ := json.Marshal(dto.User{Username: "colon", Password: "pass:word"})
+	req = httptest.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody dto.Token }
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Errorf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Authorization", "Bearer "+response.ResponseBody.AccessToken)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestLogin_ShouldChallengeMalformedCredentials(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("no-colon")))
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Basic")
+}
+
+func TestLogin_ShouldThrottleAfterFailureUntilUnlocked(t *testing.T) {
+	hash, _ := auth.HashPassword("password")
+	if err := db.Signup("guessed", hash, "user", ""); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		req.SetBasicAuth("guessed", password)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	recorder := login("password")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/admin/users/guessed/unlock", nil)
+	token, _ := auth.CreateJWT("test", "admin")
+	req.Header.Set("Token", token)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// The client is still slowed down, another client is not.
+	assert.Equal(t, http.StatusTooManyRequests, login("password").Code)
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/login", nil)
+	req.SetBasicAuth("guessed", "password")
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// loginWithPassword logs username in from clientIP, the first step of a login
+// with a one-time password.
+func loginWithPassword(t *testing.T, username, password, clientIP string) dto.MFAChallenge {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = clientIP
+	req.SetBasicAuth(username, password)
+	router.ServeHTTP(recorder, req)
+	var response struct{ ResponseBody dto.MFAChallenge }
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	return response.ResponseBody
+}
+
+func TestLogin_ShouldAskEnrolledUserForOneTimePassword(t *testing.T) {
+	hash, _ := auth.HashPassword("password")
+	if err := db.Signup("two-factor", hash, "user", ""); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	token, _ := auth.CreateJWT("two-factor", "user")
+	authorized := func(method, path string, body any) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(b))
+		req.Header.Set("Token", token)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := authorized("POST", "/mfa/totp", nil)
+	var enrollment struct{ ResponseBody dto.TOTPEnrollment }
+	if err := json.NewDecoder(recorder.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	code, err := auth.TOTPCode(enrollment.ResponseBody.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	recorder = authorized("POST", "/mfa/totp/confirm", dto.OTP{Code: code})
+	var confirmed struct{ ResponseBody dto.RecoveryCodes }
+	if err = json.NewDecoder(recorder.Body).Decode(&confirmed); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, confirmed.ResponseBody.RecoveryCodes, 10)
+	assert.Equal(t, http.StatusConflict, authorized("POST", "/mfa/totp", nil).Code)
+
+	challenge := loginWithPassword(t, "two-factor", "password", "198.51.100.10:1234")
+	assert.False(t, challenge.EnrollmentRequired)
+	recoveryCode := dto.MFALogin{ChallengeToken: challenge.ChallengeToken, Code: confirmed.ResponseBody.RecoveryCodes[0]}
+	recorder = post("/login/mfa", recoveryCode)
+	var response struct{ ResponseBody dto.MFAToken }
+	if err = json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEmpty(t, response.ResponseBody.AccessToken)
+	assert.Empty(t, response.ResponseBody.RecoveryCodes)
+
+	assert.Equal(t, http.StatusUnauthorized, post("/login/mfa", recoveryCode).Code, "spent recovery code")
+}
+
+func TestLogin_ShouldEnrollRolesRequiringMFA(t *testing.T) {
+	hash, _ := auth.HashPassword("password")
+	if err := db.Signup("new-admin", hash, "admin", ""); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	challenge := loginWithPassword(t, "new-admin", "password", "198.51.100.11:1234")
+	assert.True(t, challenge.EnrollmentRequired)
+	assert.Equal(t, http.StatusUnauthorized, post("/login/mfa/enroll", dto.MFAEnrollment{ChallengeToken: "forged"}).Code)
+
+	recorder := post("/login/mfa/enroll", dto.MFAEnrollment{ChallengeToken: challenge.ChallengeToken})
+	var enrollment struct{ ResponseBody dto.TOTPEnrollment }
+	if err := json.NewDecoder(recorder.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Contains(t, enrollment.ResponseBody.URI, "secret="+enrollment.ResponseBody.Secret)
+	code, _ := auth.TOTPCode(enrollment.ResponseBody.Secret, time.Now())
+	recorder = post("/login/mfa", dto.MFALogin{ChallengeToken: challenge.ChallengeToken, Code: code})
+	var response struct{ ResponseBody dto.MFAToken }
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, response.ResponseBody.RecoveryCodes, 10)
+
+	// The policy keeps admins from turning MFA off.
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/mfa/totp", bytes.NewBufferString(`{"code":"000000"}`))
+	req.Header.Set("Token", response.ResponseBody.AccessToken)
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
+
 func teardown() {
 	db.RunMigrations(ClearTables)
 }
@@ -474,28 +1054,63 @@ func setup() {
 	if configPath == "" {
 		log.Error("TEST_CONFIG_PATH env variable is not set")
 	}
-	if _, err := os.Stat(configPath); err != nil {
-		log.Error("errors opening config file: %s", err)
-	}
-	var cfg config.Config
-	var srv config.HTTPServer
-	err := cleanenv.ReadConfig(configPath, &cfg)
+	cfg, err := config.Load([]string{"--config", configPath})
 	if err != nil {
-		log.Error("errors opening config file: %s", err)
+		log.Error(fmt.Sprintf("errors loading config: %s", err))
+		os.Exit(1)
 	}
-	err = cleanenv.ReadConfig(configPath, &srv)
+	auth.SetSecretKey(cfg.JWT.Secret)
+	repository, err := postgres.New(cfg.Database.Name, cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port)
 	if err != nil {
-		log.Error("errors opening config file: %s", err)
+		log.Error(fmt.Sprintf("errors connecting to database: %s", err))
+		os.Exit(1)
+	}
+	if err = repository.Migrate(); err != nil {
+		log.Error(fmt.Sprintf("errors applying migrations: %s", err))
 	}
-	repository, err := postgres.New(cfg.Name, cfg.User, cfg.Password, cfg.Host, cfg.Port)
-	repository.RunMigrations(FilmTableDDl, ActorTableDDl, ActorFilmTableDDl, UserTableDDl, `INSERT INTO api_users VALUES('test', 'test', 'admin')`)
+	repository.RunMigrations(`INSERT INTO api_users VALUES('test', 'test', 'admin')`)
 	db = repository
-	middlewares := []middleware.MiddlewareFunc{middleware.VerifyJWT}
+	middlewares := []middleware.MiddlewareFunc{middleware.Authorize(policy.Parse(cfg.Authz.Roles)), middleware.Authenticate(middleware.JWTAuthenticator(repository), middleware.APIKeyAuthenticator(repository))}
 	opts := HandlerOptions{
 		BaseRouter:       *http.NewServeMux(),
 		Middlewares:      middlewares,
 		ErrorHandlerFunc: nil,
+		Features:         cfg.Features,
+	}
+	auth.ConfigurePasswords(cfg.Passwords.HashOptions())
+	passwords, err := cfg.Passwords.Policy()
+	if err != nil {
+		panic(err)
 	}
-	si := server.BasicServer{}
+	si := server.BasicServer{
+		DefaultRole: cfg.Authz.DefaultRole,
+		Roles:       cfg.Authz.RoleNames(),
+		Lockout:     lockout.New(repository, cfg.Lockout.Options()),
+		Passwords:   passwords,
+		MFARoles:    []string{"admin"},
+		AccountMail: &server.AccountMail{
+			ResetURL:  "http://localhost/reset-password",
+			VerifyURL: "http://localhost/verify-email",
+			ResetTTL:  time.Hour,
+			VerifyTTL: time.Hour,
+		},
+	}
+	outbox = mail.NewWorker(repository, &mails, cfg.Mail.WorkerOptions(), log)
 	router = HandlerWithOptions(si, &opts, repository, log)
 }
+
+func TestAdminRole_ShouldGrantRoleWithAdminScope(t *testing.T) {
+	authz := config.Authz{Roles: map[string]string{"owner": "read write admin", "user": "read"}}
+	role, err := adminRole(authz, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner", role)
+	_, err = adminRole(authz, "user")
+	assert.Error(t, err)
+
+	authz.Roles["operator"] = "read admin"
+	_, err = adminRole(authz, "")
+	assert.Error(t, err)
+	role, err = adminRole(authz, "operator")
+	assert.NoError(t, err)
+	assert.Equal(t, "operator", role)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/secrets"
+	"os"
+	"strings"
+)
+
+const secretsUsage = `usage:
+  filmbase secrets keygen            print a new SECRETS_KEY or JWT_KEYS_ENCRYPTION_KEY
+  filmbase secrets set NAME          store NAME in SECRETS_FILE, reading its value from stdin
+  filmbase secrets delete NAME       remove NAME from SECRETS_FILE`
+
+// runSecrets manages the encrypted secrets file named by SECRETS_FILE with the
+// key in SECRETS_KEY or SECRETS_KEY_FILE.
+func runSecrets(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	if args[0] == "keygen" {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generating key: %s\n", err)
+			return 1
+		}
+		fmt.Println(key)
+		return 0
+	}
+
+	path := os.Getenv("SECRETS_FILE")
+	encodedKey, _, err := secrets.Chain{secrets.EnvFile{}, secrets.Env{}}.Lookup("SECRETS_KEY")
+	if err != nil || path == "" || encodedKey == "" {
+		fmt.Fprintf(os.Stderr, "SECRETS_FILE and SECRETS_KEY must be set: %v\n", err)
+		return 1
+	}
+	key, err := secrets.ParseKey(encodedKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	values, err := secrets.ReadEncrypted(path, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "set" && len(args) == 2:
+		// The value is not taken as an argument, which would end up in the
+		// shell history and the process list.
+		fmt.Fprint(os.Stderr, "Value: ")
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		value = strings.TrimRight(value, "\r\n")
+		if value == "" {
+			fmt.Fprintf(os.Stderr, "reading value: %v\n", err)
+			return 1
+		}
+		values[args[1]] = value
+	case args[0] == "delete" && len(args) == 2:
+		delete(values, args[1])
+	default:
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	if err = secrets.WriteEncrypted(path, key, values); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/config"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/database/postgres"
+	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/Paincake/filmbase/internal/policy"
+	"os"
+	"slices"
+	"strings"
+)
+
+const createAdminUsage = `usage:
+  filmbase create-admin USERNAME [ROLE]    create an admin, reading the password from stdin
+
+ROLE must be granted the admin scope in authz.roles. It may be left out when
+only one role is.`
+
+// adminRole returns the role granted by create-admin, role when it is given or
+// else the only configured role with the admin scope.
+func adminRole(authz config.Authz, role string) (string, error) {
+	p := policy.Parse(authz.Roles)
+	var admins []string
+	for _, name := range authz.RoleNames() {
+		if p.Allows(name, []string{policy.ScopeAdmin}) {
+			admins = append(admins, name)
+		}
+	}
+	switch {
+	case role != "" && !slices.Contains(admins, role):
+		return "", fmt.Errorf("role %q is not granted the %s scope in authz.roles, one of %v is", role, policy.ScopeAdmin, admins)
+	case role != "":
+		return role, nil
+	case len(admins) == 0:
+		return "", fmt.Errorf("no role is granted the %s scope in authz.roles", policy.ScopeAdmin)
+	case len(admins) > 1:
+		return "", fmt.Errorf("several roles are granted the %s scope in authz.roles, choose one of %v", policy.ScopeAdmin, admins)
+	}
+	return admins[0], nil
+}
+
+// runCreateAdmin seeds an admin, so that the first admin does not have to be
+// created in SQL. The configuration is read from CONFIG_PATH and the environment.
+func runCreateAdmin(args []string) int {
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		fmt.Fprintln(os.Stderr, createAdminUsage)
+		return 2
+	}
+	cfg := config.MustLoad(nil)
+	var role string
+	if len(args) == 2 {
+		role = args[1]
+	}
+	role, err := adminRole(cfg.Authz, role)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "reading password: %v\n", err)
+		return 1
+	}
+	// The admin is checked as a signup would be.
+	if err = dto.Validate(dto.User{Username: args[0], Password: password}); err != nil {
+		var invalid *database.Error
+		if errors.As(err, &invalid) {
+			for _, field := range invalid.Fields {
+				fmt.Fprintf(os.Stderr, "%s %s\n", field.Field, field.Message)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return 1
+	}
+	policy, err := cfg.Passwords.Policy()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if problems := policy.Check(args[0], password); len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "password %s\n", strings.Join(problems, ", "))
+		return 1
+	}
+	auth.ConfigurePasswords(cfg.Passwords.HashOptions())
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	repository, err := postgres.New(cfg.Database.Name, cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connecting to database: %s\n", err)
+		return 1
+	}
+	defer repository.Close()
+	if err = repository.Migrate(); err != nil {
+		fmt.Fprintf(os.Stderr, "applying migrations: %s\n", err)
+		return 1
+	}
+	if err = repository.Signup(args[0], hash, role, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "creating %s: %s\n", args[0], err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Admin %s created with role %s\n", args[0], role)
+	return 0
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyPrefix marks a string as a filmbase API key, so that leaked keys are
+// easy to recognise.
+const apiKeyPrefix = "fb"
+
+// NewAPIKey returns a random API key of the form fb_<prefix>_<secret>, the
+// prefix identifying it and the hash it is stored under. The key itself is
+// never stored.
+func NewAPIKey() (key string, prefix string, hash string, err error) {
+	// The prefix is the primary key of the key, 64 bits keep it from colliding.
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	prefix = hex.EncodeToString(id)
+	key = apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashToken(key), nil
+}
+
+// ParseAPIKey returns the prefix of an API key created by NewAPIKey.
+func ParseAPIKey(key string) (prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix+"_")
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
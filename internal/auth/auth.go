@@ -1,19 +1,185 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"github.com/golang-jwt/jwt"
-	"os"
+	"github.com/google/uuid"
+	"sync"
+	"time"
 )
 
+// Options are the claims and lifetimes of issued tokens.
+type Options struct {
+	// Algorithm is the algorithm tokens are signed with. Only with HS256 are
+	// tokens signed and verified with the secret key.
+	Algorithm string
+	Issuer    string
+	Audience  string
+	// AccessTTL is the lifetime of access tokens.
+	AccessTTL time.Duration
+	// RefreshTTL is the lifetime of refresh tokens.
+	RefreshTTL time.Duration
+}
+
+// errNoSecretKey is returned rather than signing or verifying tokens with an
+// empty secret key, which anyone could forge tokens with.
+var errNoSecretKey = errors.New("no secret key")
+
+var (
+	mu        sync.RWMutex
+	secretKey []byte
+	options   = Options{
+		Algorithm:  AlgorithmHS256,
+		Issuer:     "filmbase",
+		Audience:   "filmbase",
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+)
+
+// SetSecretKey sets the key tokens are signed and verified with.
+func SetSecretKey(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+	secretKey = []byte(key)
+}
+
+// SecretKey returns the key tokens are signed and verified with.
+func SecretKey() []byte {
+	mu.RLock()
+	defer mu.RUnlock()
+	return secretKey
+}
+
+// Configure sets the claims and lifetimes of issued tokens.
+func Configure(o Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	options = o
+}
+
+// Settings returns the claims and lifetimes of issued tokens.
+func Settings() Options {
+	mu.RLock()
+	defer mu.RUnlock()
+	return options
+}
+
+// CreateJWT issues a short-lived access token for username.
 func CreateJWT(username, role string) (string, error) {
-	var sampleSecretKey = []byte(os.Getenv("JWT_SECRET_KEY"))
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["role"] = role
-	claims["username"] = username
-	tokenString, err := token.SignedString(sampleSecretKey)
+	o := Settings()
+	now := time.Now()
+	return signClaims(jwt.MapClaims{
+		"role":     role,
+		"username": username,
+		"sub":      username,
+		"jti":      uuid.NewString(),
+		"iss":      o.Issuer,
+		"aud":      o.Audience,
+		"iat":      now.Unix(),
+		"exp":      now.Add(o.AccessTTL).Unix(),
+	})
+}
+
+// signClaims signs claims with the secret key with the HS256 algorithm, with
+// the current signing key otherwise.
+func signClaims(claims jwt.MapClaims) (string, error) {
+	if Settings().Algorithm == AlgorithmHS256 {
+		key := SecretKey()
+		if len(key) == 0 {
+			return "", errNoSecretKey
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	}
+	k, ok := currentKey()
+	if !ok {
+		return "", errors.New("no signing key that is not retired")
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+// ParseJWT verifies the signature and the standard claims of an access token
+// and returns its claims. Tokens without an expiry are rejected.
+func ParseJWT(tokenString string) (jwt.MapClaims, error) {
+	return parseClaims(tokenString, Settings().Audience)
+}
+
+// parseClaims verifies the signature and the standard claims of a token issued for
+// audience and returns its claims.
+func parseClaims(tokenString string, audience string) (jwt.MapClaims, error) {
+	token, err := tokenParser.Parse(tokenString, verificationKey)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if err = verifyTimes(claims); err != nil {
+		return nil, err
+	}
+	switch {
+	case !claims.VerifyIssuer(Settings().Issuer, true):
+		return nil, errors.New("unexpected token issuer")
+	case !claims.VerifyAudience(audience, true):
+		return nil, errors.New("unexpected token audience")
+	}
+	return claims, nil
+}
+
+// clockSkew is the leeway on the times of tokens, as the clocks of the
+// instances and of the identity providers issuing them drift apart.
+const clockSkew = 30 * time.Second
+
+// tokenParser only verifies signatures, verifyTimes verifies the times with
+// leeway, which jwt.Parse does not give.
+var tokenParser = &jwt.Parser{SkipClaimsValidation: true}
+
+// verifyTimes verifies the expiry, issue and not before times of claims,
+// with clockSkew of leeway. Tokens without an expiry or an issue time are
+// rejected.
+func verifyTimes(claims jwt.MapClaims) error {
+	now := time.Now()
+	switch {
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true):
+		return errors.New("token expired or without expiry")
+	case !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), true):
+		return errors.New("token issued in the future or without issue time")
+	case !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false):
+		return errors.New("token not valid yet")
 	}
-	return tokenString, nil
+	return nil
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash it is
+// stored under. The token itself is never stored.
+func NewRefreshToken() (token string, hash string, err error) {
+	return newOpaqueToken()
+}
+
+// NewOneTimeToken returns a random token mailed for a single use, e.g. to
+// reset a password, and the hash it is stored under.
+func NewOneTimeToken() (token string, hash string, err error) {
+	return newOpaqueToken()
+}
+
+func newOpaqueToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash an opaque token is stored under.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(SecretKey())
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return token
+}
+
+func TestParseJWT_ShouldAcceptIssuedToken(t *testing.T) {
+	SetSecretKey("secret")
+	token, err := CreateJWT("test", "admin")
+	assert.NoError(t, err)
+
+	claims, err := ParseJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", claims["sub"])
+	assert.Equal(t, "admin", claims["role"])
+}
+
+func TestParseJWT_ShouldRejectInvalidClaims(t *testing.T) {
+	SetSecretKey("secret")
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "test", "iss": "filmbase", "aud": "filmbase", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+	}
+	tests := map[string]func(jwt.MapClaims){
+		"expired":          func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() },
+		"without expiry":   func(c jwt.MapClaims) { delete(c, "exp") },
+		"issued in future": func(c jwt.MapClaims) { c["iat"] = now.Add(time.Minute).Unix() },
+		"not valid yet":    func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Minute).Unix() },
+		"wrong issuer":     func(c jwt.MapClaims) { c["iss"] = "other" },
+		"wrong audience":   func(c jwt.MapClaims) { c["aud"] = "other" },
+	}
+	for name, modify := range tests {
+		claims := valid()
+		modify(claims)
+		_, err := ParseJWT(sign(t, claims))
+		assert.Error(t, err, name)
+	}
+
+	// Clocks drifting apart by less than clockSkew are tolerated.
+	skewed := valid()
+	skewed["iat"] = now.Add(10 * time.Second).Unix()
+	skewed["exp"] = now.Add(-10 * time.Second).Unix()
+	_, err := ParseJWT(sign(t, skewed))
+	assert.NoError(t, err)
+
+	SetSecretKey("")
+	_, err = ParseJWT(sign(t, valid()))
+	assert.Error(t, err, "empty secret key")
+	SetSecretKey("secret")
+
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = ParseJWT(none)
+	assert.Error(t, err)
+}
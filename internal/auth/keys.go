@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"math/big"
+	"time"
+)
+
+// Signing algorithms of access tokens. HS256 signs with the shared secret key,
+// the others with the signing keys.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+// signingKey is a parsed database.SigningKey.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	notBefore time.Time
+	retiredAt *time.Time
+}
+
+var signingKeys []signingKey
+
+// GenerateSigningKey returns a new key for algorithm, identified by a random
+// kid, that signs from now on.
+func GenerateSigningKey(algorithm string) (database.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return database.SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return database.SigningKey{}, err
+	}
+	now := time.Now()
+	return database.SigningKey{
+		ID:         uuid.NewString(),
+		Algorithm:  algorithm,
+		PrivateKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		CreatedAt:  now,
+		NotBefore:  now,
+	}, nil
+}
+
+// SetSigningKeys replaces the keys tokens are signed and verified with, unless
+// the algorithm is HS256. keys are ordered by creation, the last one that is
+// not retired and past its NotBefore signs new tokens. Every key verifies
+// tokens and is published, so that other instances can verify the tokens a
+// key signs once it is past its NotBefore.
+func SetSigningKeys(keys []database.SigningKey) error {
+	parsed := make([]signingKey, 0, len(keys))
+	for _, k := range keys {
+		key, err := parseSigningKey(k)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+		parsed = append(parsed, key)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	signingKeys = parsed
+	return nil
+}
+
+// HasSigningKey reports whether a key that is not retired signs tokens.
+func HasSigningKey() bool {
+	_, ok := currentKey()
+	return ok
+}
+
+func parseSigningKey(k database.SigningKey) (signingKey, error) {
+	block, _ := pem.Decode(k.PrivateKey)
+	if block == nil {
+		return signingKey{}, errors.New("invalid PEM")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, err
+	}
+	key := signingKey{id: k.ID, notBefore: k.NotBefore, retiredAt: k.RetiredAt}
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private = jwt.SigningMethodRS256, p
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, p
+	default:
+		return signingKey{}, fmt.Errorf("unsupported key type %T", private)
+	}
+	if key.method.Alg() != k.Algorithm {
+		return signingKey{}, fmt.Errorf("key type does not match algorithm %s", k.Algorithm)
+	}
+	return key, nil
+}
+
+// currentKey returns the newest key that is not retired and past its NotBefore.
+func currentKey() (signingKey, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	now := time.Now()
+	for i := len(signingKeys) - 1; i >= 0; i-- {
+		if signingKeys[i].retiredAt == nil && !signingKeys[i].notBefore.After(now) {
+			return signingKeys[i], true
+		}
+	}
+	return signingKey{}, false
+}
+
+// verificationKey returns the key to verify token with. Tokens signed with the
+// secret key are only verified with the HS256 algorithm.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if token.Method.Alg() == AlgorithmHS256 {
+		if options.Algorithm != AlgorithmHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+		if len(secretKey) == 0 {
+			return nil, errNoSecretKey
+		}
+		return secretKey, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	for _, k := range signingKeys {
+		if k.id != kid {
+			continue
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Header["alg"], kid)
+		}
+		return k.private.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public keys tokens may be signed with, including retired
+// keys whose tokens have not expired yet.
+func JWKS() dto.JWKS {
+	mu.RLock()
+	defer mu.RUnlock()
+	jwks := dto.JWKS{Keys: make([]dto.JWK, 0, len(signingKeys))}
+	for _, k := range signingKeys {
+		jwk := dto.JWK{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+		switch public := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// setSigningKeys sets keys and signs with the algorithm of the last one.
+func setSigningKeys(t *testing.T, keys ...database.SigningKey) {
+	if err := SetSigningKeys(keys); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	o := Settings()
+	if len(keys) > 0 {
+		withAlgorithm := o
+		withAlgorithm.Algorithm = keys[len(keys)-1].Algorithm
+		Configure(withAlgorithm)
+	}
+	t.Cleanup(func() {
+		_ = SetSigningKeys(nil)
+		Configure(o)
+	})
+}
+
+func generateSigningKey(t *testing.T, algorithm string) database.SigningKey {
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return key
+}
+
+func TestCreateJWT_ShouldSignWithNewestKey(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		old := generateSigningKey(t, AlgorithmRS256)
+		current := generateSigningKey(t, algorithm)
+		setSigningKeys(t, old, current)
+
+		token, err := CreateJWT("test", "admin")
+		assert.NoError(t, err)
+		parsed, _ := jwt.Parse(token, verificationKey)
+		assert.Equal(t, current.ID, parsed.Header["kid"])
+		assert.Equal(t, algorithm, parsed.Header["alg"])
+		_, err = ParseJWT(token)
+		assert.NoError(t, err)
+	}
+}
+
+func TestParseJWT_ShouldVerifyRetiredKey(t *testing.T) {
+	retired := generateSigningKey(t, AlgorithmEdDSA)
+	setSigningKeys(t, retired)
+	token, _ := CreateJWT("test", "admin")
+
+	now := time.Now()
+	retired.RetiredAt = &now
+	setSigningKeys(t, retired, generateSigningKey(t, AlgorithmEdDSA))
+	_, err := ParseJWT(token)
+	assert.NoError(t, err)
+
+	setSigningKeys(t, generateSigningKey(t, AlgorithmEdDSA))
+	_, err = ParseJWT(token)
+	assert.Error(t, err)
+}
+
+func TestCreateJWT_ShouldNotSignWithKeyBeforeItsNotBefore(t *testing.T) {
+	current := generateSigningKey(t, AlgorithmEdDSA)
+	pending := generateSigningKey(t, AlgorithmEdDSA)
+	pending.NotBefore = time.Now().Add(time.Minute)
+	setSigningKeys(t, current, pending)
+
+	token, err := CreateJWT("test", "admin")
+	assert.NoError(t, err)
+	parsed, _ := jwt.Parse(token, verificationKey)
+	assert.Equal(t, current.ID, parsed.Header["kid"])
+	assert.Len(t, JWKS().Keys, 2)
+
+	setSigningKeys(t, pending)
+	assert.False(t, HasSigningKey())
+}
+
+func TestParseJWT_ShouldRejectSecretKeyWithSigningKeys(t *testing.T) {
+	SetSecretKey("secret")
+	token, _ := CreateJWT("test", "admin")
+	setSigningKeys(t, generateSigningKey(t, AlgorithmRS256))
+
+	_, err := ParseJWT(token)
+	assert.Error(t, err)
+}
+
+func TestJWKS_ShouldPublishPublicKeys(t *testing.T) {
+	rsaKey := generateSigningKey(t, AlgorithmRS256)
+	edKey := generateSigningKey(t, AlgorithmEdDSA)
+	setSigningKeys(t, rsaKey, edKey)
+
+	jwks := JWKS()
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, rsaKey.ID, jwks.Keys[0].KeyID)
+		assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+		assert.Equal(t, "AQAB", jwks.Keys[0].E)
+		assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+		assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+	}
+}
+
+func TestParseJWT_ShouldRejectSecretKeyWithoutHS256(t *testing.T) {
+	key := generateSigningKey(t, AlgorithmRS256)
+	retired := time.Now()
+	key.RetiredAt = &retired
+	// Without a key that can sign, tokens are not signed with the secret key.
+	setSigningKeys(t, key)
+	SetSecretKey("")
+	_, err := CreateJWT("test", "admin")
+	assert.Error(t, err)
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "test", "role": "admin"}).SignedString([]byte{})
+	_, err = ParseJWT(forged)
+	assert.Error(t, err)
+}
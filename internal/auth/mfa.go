@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// MFAChallengeTTL is how long a user has to complete a login with a one-time
+// password once their password is verified.
+const MFAChallengeTTL = 5 * time.Minute
+
+// mfaAudienceSuffix makes the audience of MFA challenges differ from the
+// audience of access tokens, so that a challenge is never accepted as one.
+const mfaAudienceSuffix = "/mfa"
+
+// CreateMFAChallenge issues the token username presents with a one-time
+// password to complete a login.
+func CreateMFAChallenge(username string) (string, error) {
+	o := Settings()
+	now := time.Now()
+	return signClaims(jwt.MapClaims{
+		"sub": username,
+		"jti": uuid.NewString(),
+		"iss": o.Issuer,
+		"aud": o.Audience + mfaAudienceSuffix,
+		"iat": now.Unix(),
+		"exp": now.Add(MFAChallengeTTL).Unix(),
+	})
+}
+
+// ParseMFAChallenge verifies an MFA challenge and returns the username it was
+// issued to.
+func ParseMFAChallenge(token string) (string, error) {
+	claims, err := parseClaims(token, Settings().Audience+mfaAudienceSuffix)
+	if err != nil {
+		return "", err
+	}
+	username, _ := claims["sub"].(string)
+	if username == "" {
+		return "", errors.New("challenge without subject")
+	}
+	return username, nil
+}
+
+// recoveryCodeCount is the number of recovery codes a user is given at once.
+const recoveryCodeCount = 10
+
+// NewRecoveryCodes returns codes that each complete a login once in place of a
+// one-time password, and the hashes they are stored under.
+func NewRecoveryCodes() (codes []string, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 8)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash a recovery code is stored under,
+// regardless of how it was typed.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(code)
+}
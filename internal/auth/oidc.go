@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is how often the keys of an OIDC provider are fetched at
+// most, so that tokens with unknown key ids cannot flood the provider.
+const jwksRefreshInterval = time.Minute
+
+// OIDCProvider verifies tokens issued by an external OpenID Connect provider
+// against the keys it publishes. The provider is discovered on first use and
+// its keys are fetched again when a token is signed with an unknown key.
+type OIDCProvider struct {
+	Issuer   string
+	Audience string
+	Client   *http.Client
+
+	mu        sync.Mutex
+	jwksURI   string
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// NewOIDCProvider returns the provider issuing tokens as issuer for audience.
+func NewOIDCProvider(issuer, audience string) *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:   strings.TrimSuffix(issuer, "/"),
+		Audience: audience,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issued reports whether token claims to be issued by the provider. The claim
+// is not verified, it only selects the provider to verify token with.
+func (p *OIDCProvider) Issued(token string) bool {
+	return TokenIssuer(token) == p.Issuer
+}
+
+// Verify verifies the signature and the standard claims of token and returns
+// its claims.
+func (p *OIDCProvider) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	token, err := tokenParser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return p.key(ctx, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if err = verifyTimes(claims); err != nil {
+		return nil, err
+	}
+	switch {
+	case !claims.VerifyIssuer(p.Issuer, true):
+		return nil, errors.New("unexpected token issuer")
+	case !claims.VerifyAudience(p.Audience, true):
+		return nil, errors.New("unexpected token audience")
+	}
+	return claims, nil
+}
+
+// key returns the published key to verify token with.
+func (p *OIDCProvider) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.keys[kid]
+	if !ok && time.Since(p.fetchedAt) >= jwksRefreshInterval {
+		if err := p.fetchKeys(ctx); err != nil {
+			return nil, fmt.Errorf("fetching keys of %s: %w", p.Issuer, err)
+		}
+		key, ok = p.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var matches bool
+	switch key.(type) {
+	case *rsa.PublicKey:
+		_, matches = token.Method.(*jwt.SigningMethodRSA)
+	case *ecdsa.PublicKey:
+		_, matches = token.Method.(*jwt.SigningMethodECDSA)
+	case ed25519.PublicKey:
+		_, matches = token.Method.(*jwt.SigningMethodEd25519)
+	}
+	if !matches {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Header["alg"], kid)
+	}
+	return key, nil
+}
+
+// fetchKeys discovers the provider, unless it already was, and fetches its keys.
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	p.fetchedAt = time.Now()
+	if p.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.get(ctx, p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return err
+		}
+		if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer || discovery.JWKSURI == "" {
+			return fmt.Errorf("discovery document of issuer %q without jwks_uri", discovery.Issuer)
+		}
+		p.jwksURI = discovery.JWKSURI
+	}
+	var jwks dto.JWKS
+	if err := p.get(ctx, p.jwksURI, &jwks); err != nil {
+		return err
+	}
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := publicKey(jwk)
+		if err != nil {
+			// A key of an unsupported type must not reject the others.
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	p.keys = keys
+	return nil
+}
+
+func (p *OIDCProvider) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// publicKey parses a public key in the JSON Web Key format.
+func publicKey(jwk dto.JWK) (interface{}, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+}
+
+// TokenIssuer returns the unverified issuer claim of token, empty when token
+// cannot be parsed.
+func TokenIssuer(token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	iss, _ := parsed.Claims.(jwt.MapClaims)["iss"].(string)
+	return strings.TrimSuffix(iss, "/")
+}
+
+// ClaimMapping maps the claims of external tokens to users and roles.
+type ClaimMapping struct {
+	// UsernameClaim is the claim naming the user.
+	UsernameClaim string
+	// RoleClaim is the claim holding the groups or roles of the user, a string
+	// or a list of strings.
+	RoleClaim string
+	// Roles maps values of RoleClaim to roles.
+	Roles map[string]string
+	// Precedence orders roles from the highest. When several values are mapped
+	// the role that comes first gives the role, whatever the order of the
+	// values in the token. Roles missing from it come last, by name.
+	Precedence []string
+	// DefaultRole is the role of users none of whose values are mapped.
+	DefaultRole string
+}
+
+// precedes reports whether role a takes precedence over role b.
+func (m ClaimMapping) precedes(a string, b string) bool {
+	rank := func(role string) int {
+		for i, r := range m.Precedence {
+			if r == role {
+				return i
+			}
+		}
+		return len(m.Precedence)
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// Map returns the username and the role of claims.
+func (m ClaimMapping) Map(claims jwt.MapClaims) (username string, role string, err error) {
+	username, _ = claims[m.UsernameClaim].(string)
+	if username == "" {
+		return "", "", fmt.Errorf("token without %s claim", m.UsernameClaim)
+	}
+	var values []string
+	switch v := claims[m.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []interface{}:
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, value := range values {
+		if mapped, ok := m.Roles[value]; ok && (role == "" || m.precedes(mapped, role)) {
+			role = mapped
+		}
+	}
+	if role == "" {
+		return username, m.DefaultRole, nil
+	}
+	return username, role, nil
+}
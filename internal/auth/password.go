@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Password hash algorithms.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// PasswordOptions are the algorithm and the parameters passwords are hashed with.
+type PasswordOptions struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Time is the number of passes, Argon2Memory the memory in KiB and
+	// Argon2Threads the parallelism of Argon2id.
+	Argon2Time    uint32
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+	// bcryptMaxBytes is the length of the longest password bcrypt hashes.
+	bcryptMaxBytes = 72
+)
+
+var passwordOptions = PasswordOptions{
+	Algorithm:     AlgorithmArgon2id,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    2,
+	Argon2Memory:  19 * 1024,
+	Argon2Threads: 1,
+}
+
+// ConfigurePasswords sets how new passwords are hashed. Hashes made otherwise
+// are still verified, and reported by VerifyPassword to be rehashed.
+func ConfigurePasswords(o PasswordOptions) {
+	mu.Lock()
+	defer mu.Unlock()
+	passwordOptions = o
+}
+
+func passwordSettings() PasswordOptions {
+	mu.RLock()
+	defer mu.RUnlock()
+	return passwordOptions
+}
+
+// HashPassword returns the hash password is stored under.
+func HashPassword(password string) (string, error) {
+	return hashPassword(passwordSettings(), password)
+}
+
+func hashPassword(o PasswordOptions, password string) (string, error) {
+	if o.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), o.BcryptCost)
+		return string(hash), err
+	}
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, o.Argon2Time, o.Argon2Memory, o.Argon2Threads, argon2KeySize)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, o.Argon2Memory, o.Argon2Time, o.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword reports whether password matches hash and whether hash was
+// made with other options than the current ones, so that it should be
+// replaced by a new hash of password.
+func VerifyPassword(hash string, password string) (ok bool, rehash bool, err error) {
+	o := passwordSettings()
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		actual := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false, nil
+		}
+		rehash = o.Algorithm != AlgorithmArgon2id || params.Argon2Time != o.Argon2Time ||
+			params.Argon2Memory != o.Argon2Memory || params.Argon2Threads != o.Argon2Threads
+		return true, rehash, nil
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+	return true, o.Algorithm != AlgorithmBcrypt || cost != o.BcryptCost, nil
+}
+
+// parseArgon2id parses a hash in the PHC string format made by HashPassword.
+func parseArgon2id(hash string) (params PasswordOptions, salt []byte, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	return params, salt, key, nil
+}
+
+// dummy is the hash verified when a user does not exist, so that the response
+// time does not tell whether they do. It is made with the current options on
+// first use, and again once they change.
+var dummy struct {
+	sync.Mutex
+	options PasswordOptions
+	hash    string
+}
+
+func dummyHash() (string, error) {
+	o := passwordSettings()
+	dummy.Lock()
+	defer dummy.Unlock()
+	if dummy.hash == "" || dummy.options != o {
+		hash, err := hashPassword(o, "dummy")
+		if err != nil {
+			return "", err
+		}
+		dummy.options, dummy.hash = o, hash
+	}
+	return dummy.hash, nil
+}
+
+// VerifyNoPassword takes about as long as VerifyPassword, for users that do
+// not exist.
+func VerifyNoPassword(password string) {
+	if hash, err := dummyHash(); err == nil {
+		_, _, _ = VerifyPassword(hash, password)
+	}
+}
+
+// PasswordPolicy are the rules new passwords must follow.
+type PasswordPolicy struct {
+	// MinLength and MaxLength are in characters.
+	MinLength int
+	MaxLength int
+	// breached holds the uppercase hex SHA-1 hashes of breached passwords.
+	breached map[string]struct{}
+}
+
+// LoadBreachedPasswords reads the breached passwords of the file at path, one
+// per line, either the password itself or its SHA-1 hash in hex, optionally
+// followed by a colon and a count as in the Pwned Passwords lists.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); len(hash) == 2*sha1.Size && isHex(hash) {
+			breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	p.breached = breached
+	return nil
+}
+
+// Check returns every rule password of username breaks, none when it is acceptable.
+func (p *PasswordPolicy) Check(username string, password string) []string {
+	var problems []string
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+	if passwordSettings().Algorithm == AlgorithmBcrypt && len(password) > bcryptMaxBytes {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes long", bcryptMaxBytes))
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		problems = append(problems, "must not contain the username")
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		problems = append(problems, "appears in a list of breached passwords")
+	}
+	return problems
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword_ShouldAskForRehashWhenOptionsChange(t *testing.T) {
+	argon2id := PasswordOptions{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+	bcrypt := PasswordOptions{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	defer ConfigurePasswords(passwordSettings())
+
+	for _, options := range []PasswordOptions{argon2id, bcrypt} {
+		ConfigurePasswords(options)
+		hash, err := HashPassword("password")
+		if err != nil {
+			t.Fatalf("test failed: %s", err)
+		}
+		ok, rehash, err := VerifyPassword(hash, "password")
+		assert.NoError(t, err)
+		assert.True(t, ok, options.Algorithm)
+		assert.False(t, rehash, options.Algorithm)
+		ok, _, err = VerifyPassword(hash, "wrong")
+		assert.NoError(t, err)
+		assert.False(t, ok, options.Algorithm)
+	}
+
+	hash, _ := HashPassword("password")
+	ConfigurePasswords(argon2id)
+	ok, rehash, err := VerifyPassword(hash, "password")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "bcrypt hash with argon2id configured")
+
+	hash, _ = HashPassword("password")
+	ConfigurePasswords(PasswordOptions{Algorithm: AlgorithmArgon2id, Argon2Time: 2, Argon2Memory: 64, Argon2Threads: 1})
+	_, rehash, _ = VerifyPassword(hash, "password")
+	assert.True(t, rehash, "argon2id hash with more passes configured")
+}
+
+func TestVerifyNoPassword_ShouldHashWithCurrentOptions(t *testing.T) {
+	defer ConfigurePasswords(passwordSettings())
+
+	ConfigurePasswords(PasswordOptions{Algorithm: AlgorithmBcrypt, BcryptCost: 4})
+	VerifyNoPassword("password")
+	hash, _ := dummyHash()
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"), hash)
+
+	ConfigurePasswords(PasswordOptions{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1})
+	VerifyNoPassword("password")
+	hash, _ = dummyHash()
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+}
+
+func TestPasswordPolicy_ShouldReportEveryProblem(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// The SHA-1 hash of "123456789", as in the Pwned Passwords lists.
+	list := "letmein1\nF7C3BC1D808E04732ADF679965CCC34CA7AE3441:7\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 12}
+	if err := policy.LoadBreachedPasswords(path); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+
+	assert.Empty(t, policy.Check("alice", "tr0ub4dor&3"))
+	assert.Len(t, policy.Check("alice", "short"), 1)
+	assert.Len(t, policy.Check("alice", strings.Repeat("x", 13)), 1)
+	assert.Equal(t, []string{"must not contain the username"}, policy.Check("alice", "xxALICExx"))
+	assert.Equal(t, []string{"appears in a list of breached passwords"}, policy.Check("alice", "letmein1"))
+	assert.Equal(t, []string{"appears in a list of breached passwords"}, policy.Check("alice", "123456789"))
+	assert.Len(t, policy.Check("bob", "bob"), 2)
+}
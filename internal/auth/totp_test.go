@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode_ShouldMatchRFC6238(t *testing.T) {
+	// The SHA-1 test vectors of RFC 6238, truncated to 6 digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		actual, err := TOTPCode(secret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, code, actual, unix)
+	}
+}
+
+func TestVerifyTOTP_ShouldRejectReplayedAndSkewedCodes(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+
+	step, ok, err := VerifyTOTP(secret, code, now, 0)
+	assert.NoError(t, err)
+	assert.True(t, ok, "code of the previous period")
+	_, ok, _ = VerifyTOTP(secret, code, now, step)
+	assert.False(t, ok, "replayed code")
+	_, ok, _ = VerifyTOTP(secret, code, now.Add(2*totpPeriod*time.Second), 0)
+	assert.False(t, ok, "code of three periods ago")
+	assert.True(t, strings.HasPrefix(TOTPURI("filmbase", "alice", secret), "otpauth://totp/filmbase:alice?"))
+}
+
+func TestMFAChallenge_ShouldNotBeAnAccessToken(t *testing.T) {
+	SetSecretKey("secret")
+	challenge, err := CreateMFAChallenge("alice")
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	username, err := ParseMFAChallenge(challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", username)
+	_, err = ParseJWT(challenge)
+	assert.Error(t, err)
+
+	token, _ := CreateJWT("alice", "admin")
+	_, err = ParseMFAChallenge(token)
+	assert.Error(t, err)
+}
+
+func TestNewRecoveryCodes_ShouldHashRegardlessOfFormat(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Equal(t, hashes[0], HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.NotEqual(t, hashes[0], hashes[1])
+}
@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"golang.org/x/sync/singleflight"
+	"slices"
+	"time"
+)
+
+const (
+	filmPrefix   = "film:"
+	searchPrefix = "search:"
+	// revocationPrefix keeps revocation checks apart from the listings in singleflight.
+	revocationPrefix = "revocation:"
+	actorFilmsKey    = "actor_films"
+)
+
+// Repository is a read-through caching decorator for database.FilmbaseRepository.
+// Film listings, film searches and actor films are cached by their parameters,
+// write methods evict the entries they affect. Token revocation checks are
+// cached apart, so that checking every request does not evict the listings.
+// Callers get a copy of the cached listings, which they may sort or modify.
+// Every other method is passed through to the wrapped repository.
+type Repository struct {
+	database.FilmbaseRepository
+	entries     *lru
+	revocations *lru
+	group       singleflight.Group
+}
+
+func New(repository database.FilmbaseRepository, size int, ttl time.Duration) *Repository {
+	return &Repository{
+		FilmbaseRepository: repository,
+		entries:            newLRU(size, ttl),
+		revocations:        newLRU(size, ttl),
+	}
+}
+
+// load returns the value cached in entries for key or calls fn once for all
+// concurrent callers missing the same key.
+func (c *Repository) load(entries *lru, key string, fn func() (any, error)) (any, error) {
+	if v, ok := entries.get(key); ok {
+		return v, nil
+	}
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		gen := entries.gen()
+		v, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		entries.add(key, v, gen)
+		return v, nil
+	})
+	return v, err
+}
+
+func (c *Repository) GetFilm(sortBy string, sortKey string) ([]database.Film, error) {
+	key := fmt.Sprintf("%s%q:%q", filmPrefix, sortBy, sortKey)
+	v, err := c.load(c.entries, key, func() (any, error) {
+		return c.FilmbaseRepository.GetFilm(sortBy, sortKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(v.([]database.Film)), nil
+}
+
+func (c *Repository) GetFilmSearch(filmName string, actorName string, sortBy string, sortKey string) ([]database.ActorFilm, error) {
+	key := fmt.Sprintf("%s%q:%q:%q:%q", searchPrefix, filmName, actorName, sortBy, sortKey)
+	v, err := c.load(c.entries, key, func() (any, error) {
+		return c.FilmbaseRepository.GetFilmSearch(filmName, actorName, sortBy, sortKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(v.([]database.ActorFilm)), nil
+}
+
+func (c *Repository) GetActorFilms() ([]database.ActorFilm, error) {
+	v, err := c.load(c.entries, actorFilmsKey, func() (any, error) {
+		return c.FilmbaseRepository.GetActorFilms()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(v.([]database.ActorFilm)), nil
+}
+
+func (c *Repository) IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error) {
+	key := fmt.Sprintf("%s%q:%q:%d", revocationPrefix, jti, username, issuedAt.Unix())
+	v, err := c.load(c.revocations, key, func() (any, error) {
+		return c.FilmbaseRepository.IsTokenRevoked(jti, username, issuedAt)
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func (c *Repository) RevokeToken(jti string, expiresAt time.Time) error {
+	err := c.FilmbaseRepository.RevokeToken(jti, expiresAt)
+	c.invalidateRevocations()
+	return err
+}
+
+func (c *Repository) RevokeUserTokens(username string) error {
+	err := c.FilmbaseRepository.RevokeUserTokens(username)
+	c.invalidateRevocations()
+	return err
+}
+
+func (c *Repository) SetUserDisabled(username string, disabled bool) error {
+	err := c.FilmbaseRepository.SetUserDisabled(username, disabled)
+	c.invalidateRevocations()
+	return err
+}
+
+func (c *Repository) DeleteUser(username string) error {
+	err := c.FilmbaseRepository.DeleteUser(username)
+	c.invalidateRevocations()
+	return err
+}
+
+func (c *Repository) PostActor(actor database.Actor) (int64, error) {
+	id, err := c.FilmbaseRepository.PostActor(actor)
+	c.invalidateActors()
+	return id, err
+}
+
+func (c *Repository) PutActor(actor database.Actor) error {
+	err := c.FilmbaseRepository.PutActor(actor)
+	c.invalidateActors()
+	return err
+}
+
+func (c *Repository) DeleteActorById(actorId int64) error {
+	err := c.FilmbaseRepository.DeleteActorById(actorId)
+	c.invalidateActors()
+	return err
+}
+
+func (c *Repository) PostActorFilm(actorId, filmId int64) error {
+	err := c.FilmbaseRepository.PostActorFilm(actorId, filmId)
+	c.invalidateActors()
+	return err
+}
+
+func (c *Repository) PostFilm(film database.Film) (int64, error) {
+	id, err := c.FilmbaseRepository.PostFilm(film)
+	c.invalidateFilms()
+	return id, err
+}
+
+func (c *Repository) PutFilm(film database.Film) error {
+	err := c.FilmbaseRepository.PutFilm(film)
+	c.invalidateFilms()
+	return err
+}
+
+func (c *Repository) DeleteFilmById(filmId int64) error {
+	err := c.FilmbaseRepository.DeleteFilmById(filmId)
+	c.invalidateFilms()
+	return err
+}
+
+// Invalidate evicts the entries affected by a change of entity made elsewhere,
+// e.g. by another instance. Unknown entities evict everything.
+func (c *Repository) Invalidate(entity string) {
+	switch entity {
+	case database.EntityActor, database.EntityActorFilm:
+		c.invalidateActors()
+	case database.EntityRevocation:
+		c.invalidateRevocations()
+	default:
+		c.Purge()
+	}
+}
+
+// Purge evicts every entry.
+func (c *Repository) Purge() {
+	c.invalidateFilms()
+	c.invalidateRevocations()
+}
+
+// invalidateActors evicts results that join actors with their films.
+func (c *Repository) invalidateActors() {
+	c.entries.removePrefix(searchPrefix, actorFilmsKey)
+}
+
+// invalidateFilms evicts every result containing film information.
+func (c *Repository) invalidateFilms() {
+	c.entries.removePrefix(filmPrefix, searchPrefix, actorFilmsKey)
+}
+
+// invalidateRevocations evicts every revocation check.
+func (c *Repository) invalidateRevocations() {
+	c.revocations.removePrefix(revocationPrefix)
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingRepository struct {
+	database.FilmbaseRepository
+	filmCalls   atomic.Int32
+	searchCalls atomic.Int32
+	revoked     atomic.Bool
+	release     chan struct{}
+}
+
+func (r *countingRepository) GetFilm(sortBy string, sortKey string) ([]database.Film, error) {
+	r.filmCalls.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return []database.Film{{Id: 1, Name: sortBy + sortKey}}, nil
+}
+
+func (r *countingRepository) GetFilmSearch(filmName string, actorName string, sortBy string, sortKey string) ([]database.ActorFilm, error) {
+	r.searchCalls.Add(1)
+	return []database.ActorFilm{{FilmName: filmName, ActorName: actorName}}, nil
+}
+
+func (r *countingRepository) IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error) {
+	return r.revoked.Load(), nil
+}
+
+func (r *countingRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	r.revoked.Store(true)
+	return nil
+}
+
+func (r *countingRepository) PostFilm(film database.Film) (int64, error) {
+	return 1, nil
+}
+
+func (r *countingRepository) PutActor(actor database.Actor) error {
+	return nil
+}
+
+func TestGetFilm_ShouldHitCache(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Minute)
+	first, _ := c.GetFilm("rating", "DESC")
+	second, _ := c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilm("name", "DESC")
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(2), repo.filmCalls.Load())
+}
+
+func TestGetFilm_ShouldNotShareCachedSlice(t *testing.T) {
+	c := New(&countingRepository{}, 10, time.Minute)
+	first, _ := c.GetFilm("rating", "DESC")
+	first[0].Name = "changed"
+	second, _ := c.GetFilm("rating", "DESC")
+	assert.Equal(t, "ratingDESC", second[0].Name)
+}
+
+func TestGetFilm_ShouldExpire(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Millisecond)
+	_, _ = c.GetFilm("rating", "DESC")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = c.GetFilm("rating", "DESC")
+	assert.Equal(t, int32(2), repo.filmCalls.Load())
+}
+
+func TestGetFilm_ShouldEvictLeastRecentlyUsed(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 2, time.Minute)
+	_, _ = c.GetFilm("a", "")
+	_, _ = c.GetFilm("b", "")
+	_, _ = c.GetFilm("a", "")
+	_, _ = c.GetFilm("c", "")
+	assert.Equal(t, 2, c.entries.len())
+	_, _ = c.GetFilm("a", "")
+	assert.Equal(t, int32(3), repo.filmCalls.Load())
+	_, _ = c.GetFilm("b", "")
+	assert.Equal(t, int32(4), repo.filmCalls.Load())
+}
+
+func TestPostFilm_ShouldInvalidateFilms(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Minute)
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	_, _ = c.PostFilm(database.Film{Name: "new"})
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	assert.Equal(t, int32(2), repo.filmCalls.Load())
+	assert.Equal(t, int32(2), repo.searchCalls.Load())
+}
+
+func TestPutActor_ShouldKeepFilms(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Minute)
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	_ = c.PutActor(database.Actor{Name: "new"})
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	assert.Equal(t, int32(1), repo.filmCalls.Load())
+	assert.Equal(t, int32(2), repo.searchCalls.Load())
+}
+
+func TestInvalidate_ShouldEvictByEntity(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Minute)
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	c.Invalidate(database.EntityActorFilm)
+	_, _ = c.GetFilm("rating", "DESC")
+	_, _ = c.GetFilmSearch("f", "a", "rating", "DESC")
+	c.Invalidate(database.EntityFilm)
+	_, _ = c.GetFilm("rating", "DESC")
+	assert.Equal(t, int32(2), repo.filmCalls.Load())
+	assert.Equal(t, int32(2), repo.searchCalls.Load())
+}
+
+func TestGetFilm_ShouldCoalesceConcurrentMisses(t *testing.T) {
+	repo := &countingRepository{release: make(chan struct{})}
+	c := New(repo, 10, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = c.GetFilm("rating", "DESC")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), repo.filmCalls.Load())
+}
+
+func TestRevokeToken_ShouldEvictRevocationsOnly(t *testing.T) {
+	repo := &countingRepository{}
+	c := New(repo, 10, time.Minute)
+	issuedAt := time.Now()
+	_, _ = c.GetFilm("rating", "DESC")
+	revoked, _ := c.IsTokenRevoked("jti", "test", issuedAt)
+	assert.False(t, revoked)
+
+	_ = c.RevokeToken("jti", issuedAt.Add(time.Minute))
+	revoked, _ = c.IsTokenRevoked("jti", "test", issuedAt)
+	assert.True(t, revoked)
+	_, _ = c.GetFilm("rating", "DESC")
+	assert.Equal(t, int32(1), repo.filmCalls.Load())
+}
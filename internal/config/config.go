@@ -1,48 +1,371 @@
 package config
 
 import (
-	"github.com/ilyakaznacheev/cleanenv"
-	"log"
-	"log/slog"
-	"os"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/lockout"
+	"github.com/Paincake/filmbase/internal/mail"
+	"github.com/Paincake/filmbase/internal/ratelimit"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Config is the configuration tree of the service. Every setting can be given
+// in the config file under its yaml key, in the environment variable named by
+// its env tag, or as a command line flag named after the variable, e.g.
+// --http-server-address for HTTP_SERVER_ADDRESS. The default tag applies when
+// a setting is given nowhere. Settings tagged secret are redacted when printed.
 type Config struct {
-	Env      string `env:"ENV" env_default:"local"`
-	Port     string `env:"DB_PORT" env_default:"5432"`
-	Host     string `env:"DB_HOST" env_default:"localhost"`
-	Name     string `env:"DB_NAME" env_default:"postgres"`
-	User     string `env:"DB_USER" env_default:"user"`
-	Password string `env:"DB_PASSWORD" env_default:"password"`
+	Env        string     `yaml:"env" env:"ENV" default:"local"`
+	Database   Database   `yaml:"database"`
+	HTTPServer HTTPServer `yaml:"http_server"`
+	JWT        JWT        `yaml:"jwt"`
+	Authz      Authz      `yaml:"authz"`
+	OIDC       OIDC       `yaml:"oidc"`
+	Lockout    Lockout    `yaml:"lockout"`
+	Passwords  Passwords  `yaml:"passwords"`
+	Mail       Mail       `yaml:"mail"`
+	Log        Log        `yaml:"log"`
+	CORS       CORS       `yaml:"cors"`
+	RateLimit  RateLimit  `yaml:"rate_limit"`
+	Cache      Cache      `yaml:"cache"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Features   Features   `yaml:"features"`
+	Secrets    Secrets    `yaml:"secrets"`
 }
 
+// Environment variables of the secrets that can be refreshed at runtime.
+const (
+	DBPasswordEnv   = "DB_PASSWORD"
+	JWTSecretEnv    = "JWT_SECRET_KEY"
+	SMTPPasswordEnv = "MAIL_SMTP_PASSWORD"
+)
+
+type Database struct {
+	Port     string `yaml:"port" env:"DB_PORT" default:"5432"`
+	Host     string `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Name     string `yaml:"name" env:"DB_NAME" default:"postgres"`
+	User     string `yaml:"user" env:"DB_USER" default:"user"`
+	Password string `yaml:"password" env:"DB_PASSWORD" default:"password" secret:"true"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"20"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"5"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+}
+
+// HTTPServer configures the listener. The deprecated HTTP_SERVER_TIMEOUT sets
+// both ReadTimeout and WriteTimeout unless they are set themselves.
 type HTTPServer struct {
-	Address     string        `env:"HTTP_SERVER_ADDRESS" env_default:"0.0.0.0:8082"`
-	Timeout     time.Duration `env:"HTTP_SERVER_TIMEOUT" env_default: "4s"`
-	IdleTimeout time.Duration `env:"HTTP_SERVER_IDLE_TIMEOUT" env_default: "30s"`
+	Address         string        `yaml:"address" env:"HTTP_SERVER_ADDRESS" default:"0.0.0.0:8082"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"HTTP_SERVER_READ_TIMEOUT" default:"4s"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"HTTP_SERVER_WRITE_TIMEOUT" default:"4s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"HTTP_SERVER_IDLE_TIMEOUT" default:"30s"`
+	MaxHeaderBytes  int           `yaml:"max_header_bytes" env:"HTTP_SERVER_MAX_HEADER_BYTES" default:"1048576"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SERVER_SHUTDOWN_TIMEOUT" default:"10s"`
+
+	// TLS is served when both the certificate and the key file are set.
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"HTTP_SERVER_TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"HTTP_SERVER_TLS_KEY_FILE"`
+	TLSReloadInterval time.Duration `yaml:"tls_reload_interval" env:"HTTP_SERVER_TLS_RELOAD_INTERVAL" default:"1m"`
+	// TLSClientCAFile enables verification of client certificates.
+	TLSClientCAFile string `yaml:"tls_client_ca_file" env:"HTTP_SERVER_TLS_CLIENT_CA_FILE"`
+	// TLSClientRoles maps subject alternative names or full subjects of client
+	// certificates to roles, e.g. "dns:batch.example.com:admin,uri:spiffe://example.com/reports:user".
+	// Subjects contain commas, so "dn:CN=batch,O=Filmbase" is only set in the
+	// file. The roles must not be in authz.mfa_roles.
+	TLSClientRoles map[string]string `yaml:"tls_client_roles" env:"HTTP_SERVER_TLS_CLIENT_ROLES"`
+}
+
+type JWT struct {
+	// Algorithm is one of HS256, RS256 or EdDSA. HS256 signs with Secret, the
+	// others with the signing keys stored in the database, see the keys command,
+	// and require KeysEncryptionKey.
+	Algorithm string `yaml:"algorithm" env:"JWT_ALGORITHM" default:"HS256"`
+	Secret    string `yaml:"secret" env:"JWT_SECRET_KEY" secret:"true"`
+	// KeysEncryptionKey is the base64 encoded 32 byte key the private signing
+	// keys are encrypted with in the database, see "filmbase secrets keygen".
+	KeysEncryptionKey string `yaml:"keys_encryption_key" env:"JWT_KEYS_ENCRYPTION_KEY" secret:"true"`
+	// KeysRefreshInterval is how often the signing keys are reloaded from the database.
+	KeysRefreshInterval time.Duration `yaml:"keys_refresh_interval" env:"JWT_KEYS_REFRESH_INTERVAL" default:"1m"`
+	Issuer              string        `yaml:"issuer" env:"JWT_ISSUER" default:"filmbase"`
+	Audience            string        `yaml:"audience" env:"JWT_AUDIENCE" default:"filmbase"`
+	// AccessTTL is the lifetime of access tokens, keep it short as they cannot be revoked.
+	AccessTTL time.Duration `yaml:"access_ttl" env:"JWT_ACCESS_TTL" default:"15m"`
+	// RefreshTTL is the lifetime of refresh tokens.
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env:"JWT_REFRESH_TTL" default:"720h"`
+	// PruneInterval is how often expired refresh tokens and revocations are deleted.
+	PruneInterval time.Duration `yaml:"prune_interval" env:"JWT_PRUNE_INTERVAL" default:"1h"`
+}
+
+type Authz struct {
+	// Roles maps roles to the space separated scopes they are granted, one of
+	// read, write or admin, e.g. "admin:read write admin,user:read".
+	Roles map[string]string `yaml:"roles" env:"AUTHZ_ROLES" default:"admin:read write admin,user:read"`
+	// DefaultRole is the role of signed up users.
+	DefaultRole string `yaml:"default_role" env:"AUTHZ_DEFAULT_ROLE" default:"user"`
+	// MFARoles are the roles that must log in with a one-time password, e.g.
+	// "admin". Their users enroll a TOTP secret on their next login.
+	MFARoles []string `yaml:"mfa_roles" env:"AUTHZ_MFA_ROLES"`
+}
+
+// RoleNames returns the configured roles in order.
+func (a Authz) RoleNames() []string {
+	names := make([]string, 0, len(a.Roles))
+	for role := range a.Roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OIDC accepts the tokens of an external OpenID Connect provider besides the
+// tokens issued by the service when Issuer is set.
+type OIDC struct {
+	// Issuer is the URL of the provider, its keys are discovered from it.
+	Issuer string `yaml:"issuer" env:"OIDC_ISSUER"`
+	// Audience is the client id tokens must be issued for.
+	Audience      string `yaml:"audience" env:"OIDC_AUDIENCE"`
+	UsernameClaim string `yaml:"username_claim" env:"OIDC_USERNAME_CLAIM" default:"preferred_username"`
+	// RoleClaim is the claim holding the groups or roles of the user.
+	RoleClaim string `yaml:"role_claim" env:"OIDC_ROLE_CLAIM" default:"roles"`
+	// Roles maps values of RoleClaim to roles, e.g. "filmbase-admins:admin".
+	// The roles and DefaultRole must not be in authz.mfa_roles, as provider
+	// tokens are not asked for a one-time password.
+	Roles map[string]string `yaml:"roles" env:"OIDC_ROLES"`
+	// RolePrecedence orders the roles of Roles from the highest, e.g.
+	// "admin,user". Users in groups mapped to several roles get the highest.
+	RolePrecedence []string `yaml:"role_precedence" env:"OIDC_ROLE_PRECEDENCE"`
+	// DefaultRole is the role of users none of whose values are mapped, no
+	// role at all when empty.
+	DefaultRole string `yaml:"default_role" env:"OIDC_DEFAULT_ROLE"`
+}
+
+// ClaimMapping returns how the claims of provider tokens map to users.
+func (o OIDC) ClaimMapping() auth.ClaimMapping {
+	return auth.ClaimMapping{
+		UsernameClaim: o.UsernameClaim,
+		RoleClaim:     o.RoleClaim,
+		Roles:         o.Roles,
+		Precedence:    o.RolePrecedence,
+		DefaultRole:   o.DefaultRole,
+	}
+}
+
+// Lockout slows down password guessing on login, see lockout.Options.
+type Lockout struct {
+	Enabled bool `yaml:"enabled" env:"LOCKOUT_ENABLED" default:"true"`
+	// Store is where failed logins are counted, database to share them between
+	// instances or memory.
+	Store             string        `yaml:"store" env:"LOCKOUT_STORE" default:"database"`
+	MaxUserFailures   int           `yaml:"max_user_failures" env:"LOCKOUT_MAX_USER_FAILURES" default:"5"`
+	MaxClientFailures int           `yaml:"max_client_failures" env:"LOCKOUT_MAX_CLIENT_FAILURES" default:"50"`
+	Duration          time.Duration `yaml:"duration" env:"LOCKOUT_DURATION" default:"15m"`
+	BaseDelay         time.Duration `yaml:"base_delay" env:"LOCKOUT_BASE_DELAY" default:"1s"`
+	MaxDelay          time.Duration `yaml:"max_delay" env:"LOCKOUT_MAX_DELAY" default:"1m"`
+	// PruneInterval is how often failed logins that were forgotten are deleted.
+	PruneInterval time.Duration `yaml:"prune_interval" env:"LOCKOUT_PRUNE_INTERVAL" default:"1h"`
+}
+
+// Options returns the limits of failed logins.
+func (l Lockout) Options() lockout.Options {
+	return lockout.Options{
+		MaxUserFailures:   l.MaxUserFailures,
+		MaxClientFailures: l.MaxClientFailures,
+		LockoutDuration:   l.Duration,
+		BaseDelay:         l.BaseDelay,
+		MaxDelay:          l.MaxDelay,
+	}
+}
+
+// Passwords are how passwords are hashed and the rules new ones must follow.
+// Stored hashes made otherwise are replaced on the next login.
+type Passwords struct {
+	// Algorithm is one of argon2id or bcrypt.
+	Algorithm  string `yaml:"algorithm" env:"PASSWORD_ALGORITHM" default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST" default:"10"`
+	// Argon2Time is the number of passes, Argon2Memory the memory in KiB.
+	Argon2Time    int `yaml:"argon2_time" env:"PASSWORD_ARGON2_TIME" default:"2"`
+	Argon2Memory  int `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY" default:"19456"`
+	Argon2Threads int `yaml:"argon2_threads" env:"PASSWORD_ARGON2_THREADS" default:"1"`
+	MinLength     int `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" default:"8"`
+	MaxLength     int `yaml:"max_length" env:"PASSWORD_MAX_LENGTH" default:"64"`
+	// BreachedFile lists passwords that are rejected, in plain or as SHA-1
+	// hashes, one per line.
+	BreachedFile string `yaml:"breached_file" env:"PASSWORD_BREACHED_FILE"`
+}
+
+// HashOptions returns how passwords are hashed.
+func (p Passwords) HashOptions() auth.PasswordOptions {
+	return auth.PasswordOptions{
+		Algorithm:     p.Algorithm,
+		BcryptCost:    p.BcryptCost,
+		Argon2Time:    uint32(p.Argon2Time),
+		Argon2Memory:  uint32(p.Argon2Memory),
+		Argon2Threads: uint8(p.Argon2Threads),
+	}
 }
 
-func MustLoad() (*Config, *HTTPServer) {
-	configPath := os.Getenv("CONFIG_PATH")
-	if configPath == "" {
-		log.Fatal("CONFIG_PATH env variable is not set")
+// Policy returns the rules new passwords must follow, reading the breached passwords.
+func (p Passwords) Policy() (*auth.PasswordPolicy, error) {
+	policy := &auth.PasswordPolicy{MinLength: p.MinLength, MaxLength: p.MaxLength}
+	if p.BreachedFile != "" {
+		if err := policy.LoadBreachedPasswords(p.BreachedFile); err != nil {
+			return nil, fmt.Errorf("loading breached passwords: %w", err)
+		}
 	}
-	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	if _, err := os.Stat(configPath); err != nil {
-		log.Error("errors opening config file: %s", err)
+	return policy, nil
+}
+
+// Mail is how password reset and email verification mail is sent. Mail is
+// queued in the database and sent by a worker, so that it survives restarts.
+type Mail struct {
+	// Transport is one of none, smtp, file or log. With none, passwords cannot
+	// be reset and emails are not verified. file and log keep the mailed
+	// tokens and are only allowed in the local env.
+	Transport string `yaml:"transport" env:"MAIL_TRANSPORT" default:"none"`
+	// From is the sender, e.g. "Filmbase <noreply@example.com>".
+	From string `yaml:"from" env:"MAIL_FROM" default:"filmbase@localhost"`
+	// SMTPAddress is the host:port of the SMTP server.
+	SMTPAddress  string `yaml:"smtp_address" env:"MAIL_SMTP_ADDRESS"`
+	SMTPUsername string `yaml:"smtp_username" env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"MAIL_SMTP_PASSWORD" secret:"true"`
+	// File is the mbox file the file transport appends to.
+	File string `yaml:"file" env:"MAIL_FILE" default:"mail.mbox"`
+	// ResetURL and VerifyURL are the pages the mailed links lead to, they get
+	// the token as the token query parameter.
+	ResetURL  string        `yaml:"reset_url" env:"MAIL_RESET_URL" default:"http://localhost:3000/reset-password"`
+	VerifyURL string        `yaml:"verify_url" env:"MAIL_VERIFY_URL" default:"http://localhost:3000/verify-email"`
+	ResetTTL  time.Duration `yaml:"reset_ttl" env:"MAIL_RESET_TTL" default:"1h"`
+	VerifyTTL time.Duration `yaml:"verify_ttl" env:"MAIL_VERIFY_TTL" default:"48h"`
+	// PollInterval is how often the outbox is checked for mail to send.
+	PollInterval time.Duration `yaml:"poll_interval" env:"MAIL_POLL_INTERVAL" default:"5s"`
+	SendTimeout  time.Duration `yaml:"send_timeout" env:"MAIL_SEND_TIMEOUT" default:"30s"`
+	// MaxAttempts is the number of attempts to send a message before giving up on it.
+	MaxAttempts int `yaml:"max_attempts" env:"MAIL_MAX_ATTEMPTS" default:"10"`
+	// Retention is how long sent mail is kept in the outbox.
+	Retention time.Duration `yaml:"retention" env:"MAIL_RETENTION" default:"168h"`
+	// PruneInterval is how often mail sent longer than Retention ago is deleted.
+	PruneInterval time.Duration `yaml:"prune_interval" env:"MAIL_PRUNE_INTERVAL" default:"1h"`
+}
+
+// WorkerOptions returns how the mail of the outbox is sent.
+func (m Mail) WorkerOptions() mail.WorkerOptions {
+	return mail.WorkerOptions{
+		BatchSize:   20,
+		SendTimeout: m.SendTimeout,
+		MaxAttempts: m.MaxAttempts,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
 	}
+}
+
+type Log struct {
+	// Level is one of debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+}
+
+// CORS is enabled when at least one origin is allowed.
+type CORS struct {
+	AllowedOrigins []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,DELETE"`
+	AllowedHeaders []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Authorization,Content-Type,Token,X-Request-ID"`
+	MaxAge         time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" default:"10m"`
+}
 
-	var cfg Config
-	var server HTTPServer
-	err := cleanenv.ReadConfig(configPath, &cfg)
-	if err != nil {
-		log.Error("errors opening config file: %s", err)
+// RateLimit limits the requests of every user, and of every client address on
+// anonymous routes, see ratelimit.Options.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// Rate is the number of requests per second a client is allowed to sustain.
+	Rate float64 `yaml:"rate" env:"RATE_LIMIT_RATE" default:"10"`
+	// Burst is the number of requests a client may send at once.
+	Burst int `yaml:"burst" env:"RATE_LIMIT_BURST" default:"20"`
+	// ClientRate and ClientBurst limit every client address before it is
+	// authenticated, so that requests failing authentication are limited too.
+	// Keep them above the limits of the users sharing an address.
+	ClientRate  float64 `yaml:"client_rate" env:"RATE_LIMIT_CLIENT_RATE" default:"50"`
+	ClientBurst int     `yaml:"client_burst" env:"RATE_LIMIT_CLIENT_BURST" default:"100"`
+	// Roles maps roles to the space separated rate and burst of their users,
+	// e.g. "admin:50 100".
+	Roles map[string]string `yaml:"roles" env:"RATE_LIMIT_ROLES"`
+	// Routes maps routes to the space separated rate and burst of each client
+	// on them, e.g. "POST /login:0.5 10".
+	Routes map[string]string `yaml:"routes" env:"RATE_LIMIT_ROUTES" default:"POST /login:0.5 10,POST /sign:0.1 5,POST /password/forgot:0.1 5"`
+	// PruneInterval is how often the buckets of clients that are back to their
+	// full burst are forgotten.
+	PruneInterval time.Duration `yaml:"prune_interval" env:"RATE_LIMIT_PRUNE_INTERVAL" default:"1m"`
+}
+
+// Options returns the limits of clients. Limits that do not parse are left
+// out, they are reported by validation.
+func (r RateLimit) Options() ratelimit.Options {
+	opts := ratelimit.Options{
+		Default: ratelimit.Limit{Rate: r.Rate, Burst: r.Burst},
+		Roles:   make(map[string]ratelimit.Limit),
+		Routes:  make(map[string]ratelimit.Limit),
+	}
+	for role, value := range r.Roles {
+		if limit, err := parseLimit(value); err == nil {
+			opts.Roles[role] = limit
+		}
 	}
-	err = cleanenv.ReadConfig(configPath, &server)
-	if err != nil {
-		log.Error("errors opening config file: %s", err)
+	for route, value := range r.Routes {
+		if limit, err := parseLimit(value); err == nil {
+			opts.Routes[route] = limit
+		}
 	}
+	return opts
+}
+
+// ClientOptions returns the limits of client addresses before authentication.
+func (r RateLimit) ClientOptions() ratelimit.Options {
+	return ratelimit.Options{Default: ratelimit.Limit{Rate: r.ClientRate, Burst: r.ClientBurst}}
+}
+
+// parseLimit parses a positive rate and burst separated by a space.
+func parseLimit(value string) (ratelimit.Limit, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return ratelimit.Limit{}, fmt.Errorf("want a rate and a burst, got %q", value)
+	}
+	rate, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return ratelimit.Limit{}, fmt.Errorf("rate must be a positive number, got %q", fields[0])
+	}
+	burst, err := strconv.Atoi(fields[1])
+	if err != nil || burst <= 0 {
+		return ratelimit.Limit{}, fmt.Errorf("burst must be a positive integer, got %q", fields[1])
+	}
+	return ratelimit.Limit{Rate: rate, Burst: burst}, nil
+}
+
+type Cache struct {
+	Size int           `yaml:"size" env:"CACHE_SIZE" default:"1024"`
+	TTL  time.Duration `yaml:"ttl" env:"CACHE_TTL" default:"30s"`
+}
+
+type Tracing struct {
+	// Exporter is one of none, stdout or otlp.
+	Exporter string `yaml:"exporter" env:"TRACE_EXPORTER" default:"none"`
+}
+
+type Features struct {
+	Cache   bool `yaml:"cache" env:"FEATURE_CACHE" default:"true"`
+	Metrics bool `yaml:"metrics" env:"FEATURE_METRICS" default:"true"`
+	Signup  bool `yaml:"signup" env:"FEATURE_SIGNUP" default:"true"`
+}
 
-	return &cfg, &server
+// Secrets configures where secrets are looked up besides the config file and the
+// environment. Every secret can be read from the file named by its variable
+// suffixed with _FILE, e.g. JWT_SECRET_KEY_FILE, and from the encrypted File.
+type Secrets struct {
+	// File is a secrets file encrypted with Key, a base64 encoded AES-256 key.
+	File string `yaml:"file" env:"SECRETS_FILE"`
+	Key  string `yaml:"key" env:"SECRETS_KEY" secret:"true"`
+	// RefreshInterval is how often secrets are reloaded, they are also reloaded on SIGHUP.
+	RefreshInterval time.Duration `yaml:"refresh_interval" env:"SECRETS_REFRESH_INTERVAL"`
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// keysEncryptionKey is a valid jwt.keys_encryption_key, required by the RS256
+// and EdDSA algorithms.
+const keysEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return path
+}
+
+func TestLoad_ShouldLayerFileEnvAndFlags(t *testing.T) {
+	path := writeConfig(t, `
+database:
+  host: file-host
+  port: "6432"
+http_server:
+  address: 127.0.0.1:9000
+  read_timeout: 7s
+features:
+  cache: false
+`)
+	t.Setenv("JWT_SECRET_KEY", "secret")
+	t.Setenv("DB_PORT", "7432")
+	t.Setenv("HTTP_SERVER_ADDRESS", "127.0.0.1:9001")
+
+	cfg, err := Load([]string{"--config", path, "--http-server-address", "127.0.0.1:9002"})
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, "file-host", cfg.Database.Host)
+	assert.Equal(t, "7432", cfg.Database.Port)
+	assert.Equal(t, "127.0.0.1:9002", cfg.HTTPServer.Address)
+	assert.Equal(t, 7*time.Second, cfg.HTTPServer.ReadTimeout)
+	assert.Equal(t, 30*time.Second, cfg.HTTPServer.IdleTimeout)
+	assert.False(t, cfg.Features.Cache)
+	assert.True(t, cfg.Features.Metrics)
+}
+
+func TestLoad_ShouldReplaceDefaultMaps(t *testing.T) {
+	path := writeConfig(t, `
+authz:
+  roles:
+    admin: read write admin
+    viewer: read
+  default_role: viewer
+`)
+	t.Setenv("JWT_SECRET_KEY", "secret")
+	cfg, err := Load([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, map[string]string{"admin": "read write admin", "viewer": "read"}, cfg.Authz.Roles)
+	assert.Contains(t, cfg.RateLimit.Routes, "POST /login")
+}
+
+func TestLoad_ShouldHonourDeprecatedTimeout(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "secret")
+	t.Setenv("HTTP_SERVER_TIMEOUT", "9s")
+	t.Setenv("HTTP_SERVER_WRITE_TIMEOUT", "6s")
+	cfg, opts, err := load(nil)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, "0.0.0.0:8082", cfg.HTTPServer.Address)
+	assert.Equal(t, 9*time.Second, cfg.HTTPServer.ReadTimeout)
+	assert.Equal(t, 6*time.Second, cfg.HTTPServer.WriteTimeout)
+	assert.Len(t, opts.warnings, 1)
+}
+
+func TestLoad_ShouldReportEveryInvalidSetting(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "")
+	_, err := Load([]string{"--db-port", "port", "--log-level", "verbose", "--http-server-tls-cert-file", "tls.crt", "--jwt-algorithm", "HS256", "--oidc-issuer", "ftp://idp", "--oidc-roles", "admins:admin,users:user", "--http-server-tls-client-roles", "batch:admin,dns:ci.example.com:admin", "--authz-mfa-roles", "admin", "--mail-transport", "smtp", "--rate-limit-routes", "POST /login:fast 10"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "database.port")
+		assert.Contains(t, err.Error(), "log.level")
+		assert.Contains(t, err.Error(), "http_server.tls_cert_file")
+		assert.Contains(t, err.Error(), "jwt.secret")
+		assert.Contains(t, err.Error(), "oidc.issuer")
+		assert.Contains(t, err.Error(), "oidc.audience")
+		assert.Contains(t, err.Error(), "oidc.role_precedence")
+		assert.Contains(t, err.Error(), `oidc.roles: value "admins": role "admin" requires MFA`)
+		assert.Contains(t, err.Error(), `http_server.tls_client_roles: name "batch": must start with`)
+		assert.Contains(t, err.Error(), `http_server.tls_client_roles: name "dns:ci.example.com": role "admin" requires MFA`)
+		assert.Contains(t, err.Error(), "mail.smtp_address")
+		assert.Contains(t, err.Error(), `rate_limit.routes: route "POST /login": rate must be a positive number`)
+	}
+}
+
+func TestPrint_ShouldRedactSecrets(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "very-secret")
+	t.Setenv("DB_PASSWORD", "db-secret")
+	t.Setenv("JWT_KEYS_ENCRYPTION_KEY", keysEncryptionKey)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, Print(&buf, cfg))
+	assert.NotContains(t, buf.String(), "very-secret")
+	assert.NotContains(t, buf.String(), "db-secret")
+	assert.NotContains(t, buf.String(), keysEncryptionKey)
+	assert.Contains(t, buf.String(), redacted)
+	assert.Equal(t, "very-secret", cfg.JWT.Secret)
+}
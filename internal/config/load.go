@@ -0,0 +1,318 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/secrets"
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+type options struct {
+	configPath  string
+	printConfig bool
+	// warnings are the deprecated settings that were used.
+	warnings []string
+}
+
+// MustLoad loads and validates the configuration from args, exiting with every
+// problem found when it is invalid. With --print-config the effective
+// configuration is printed with its secrets redacted and the process exits.
+func MustLoad(args []string) *Config {
+	cfg, opts, err := load(args)
+	for _, warning := range opts.warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(1)
+	}
+	if opts.printConfig {
+		if err = Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "printing configuration: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	return cfg
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the command line flags in args, each overriding the previous
+// one, and validates it. The config file is given by --config or CONFIG_PATH
+// and is optional.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := load(args)
+	return cfg, err
+}
+
+func load(args []string) (*Config, options, error) {
+	var cfg Config
+	var opts options
+	fields := collectFields(reflect.ValueOf(&cfg).Elem(), "")
+
+	fs := flag.NewFlagSet("filmbase", flag.ContinueOnError)
+	fs.StringVar(&opts.configPath, "config", os.Getenv("CONFIG_PATH"), "path to the config file")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "print the effective configuration and exit")
+	flagFields := make(map[string]field)
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		name := strings.ReplaceAll(strings.ToLower(f.env), "_", "-")
+		fs.String(name, "", fmt.Sprintf("overrides %s (%s)", f.path, f.env))
+		flagFields[name] = f
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, opts, err
+	}
+
+	if err := setDefaults(fields, false); err != nil {
+		return nil, opts, err
+	}
+
+	if opts.configPath != "" {
+		if err := cleanenv.ReadConfig(opts.configPath, &cfg); err != nil {
+			return nil, opts, fmt.Errorf("reading %s: %w", opts.configPath, err)
+		}
+	} else if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, opts, fmt.Errorf("reading environment: %w", err)
+	}
+
+	if err := setDefaults(fields, true); err != nil {
+		return nil, opts, err
+	}
+
+	warnings, err := applyDeprecatedEnv(&cfg)
+	opts.warnings = warnings
+	if err != nil {
+		return nil, opts, err
+	}
+
+	if err := resolveSecrets(&cfg, fields); err != nil {
+		return nil, opts, err
+	}
+
+	var errs []error
+	fs.Visit(func(fl *flag.Flag) {
+		f, ok := flagFields[fl.Name]
+		if !ok {
+			return
+		}
+		if err := setValue(f.value, fl.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", fl.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, opts, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, opts, err
+	}
+	return &cfg, opts, nil
+}
+
+// applyDeprecatedEnv sets the fields that replaced deprecated environment
+// variables from them, unless the new variables are set, and returns a warning
+// for every deprecated variable found.
+func applyDeprecatedEnv(cfg *Config) ([]string, error) {
+	var warnings []string
+	// HTTP_SERVER_TIMEOUT was split into the read and the write timeouts.
+	if raw, ok := os.LookupEnv("HTTP_SERVER_TIMEOUT"); ok {
+		warnings = append(warnings, "HTTP_SERVER_TIMEOUT is deprecated, set HTTP_SERVER_READ_TIMEOUT and HTTP_SERVER_WRITE_TIMEOUT instead")
+		timeout, err := time.ParseDuration(raw)
+		if err != nil {
+			return warnings, fmt.Errorf("HTTP_SERVER_TIMEOUT: %w", err)
+		}
+		if _, ok := os.LookupEnv("HTTP_SERVER_READ_TIMEOUT"); !ok {
+			cfg.HTTPServer.ReadTimeout = timeout
+		}
+		if _, ok := os.LookupEnv("HTTP_SERVER_WRITE_TIMEOUT"); !ok {
+			cfg.HTTPServer.WriteTimeout = timeout
+		}
+	}
+	return warnings, nil
+}
+
+// setDefaults sets the defaults of the maps of fields that are still unset
+// when maps is true, of the other fields otherwise. Maps are defaulted once
+// the file and the environment are read, as yaml merges the file into a map
+// rather than replacing it, so that a default role could not be removed.
+func setDefaults(fields []field, maps bool) error {
+	for _, f := range fields {
+		isMap := f.value.Kind() == reflect.Map
+		if f.def == "" || isMap != maps || (isMap && !f.value.IsNil()) {
+			continue
+		}
+		if err := setValue(f.value, f.def); err != nil {
+			return fmt.Errorf("%s: invalid default %q: %w", f.path, f.def, err)
+		}
+	}
+	return nil
+}
+
+// SecretProvider returns the provider looking secrets up in *_FILE files and in
+// the encrypted secrets file.
+func (c *Config) SecretProvider() (secrets.Provider, error) {
+	chain := secrets.Chain{secrets.EnvFile{}}
+	if c.Secrets.File == "" {
+		return chain, nil
+	}
+	key, err := secrets.ParseKey(c.Secrets.Key)
+	if err != nil {
+		return nil, fmt.Errorf("secrets.key: %w", err)
+	}
+	return append(chain, secrets.Encrypted{Path: c.Secrets.File, Key: key}), nil
+}
+
+// SecretValues returns the value of every secret by its environment variable.
+func (c *Config) SecretValues() map[string]string {
+	values := make(map[string]string)
+	for _, f := range collectFields(reflect.ValueOf(c).Elem(), "") {
+		if f.secret && f.env != "" {
+			values[f.env] = f.value.String()
+		}
+	}
+	return values
+}
+
+// resolveSecrets overrides the secrets of cfg with those found by its provider.
+// The key of the encrypted secrets file is resolved first, as the provider
+// needs it.
+func resolveSecrets(cfg *Config, fields []field) error {
+	key, ok, err := secrets.EnvFile{}.Lookup("SECRETS_KEY")
+	if err != nil {
+		return err
+	}
+	if ok {
+		cfg.Secrets.Key = key
+	}
+	provider, err := cfg.SecretProvider()
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if !f.secret || f.env == "" {
+			continue
+		}
+		value, ok, err := provider.Lookup(f.env)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		if ok {
+			f.value.SetString(value)
+		}
+	}
+	return nil
+}
+
+// Print writes cfg as yaml with every secret redacted.
+func Print(w io.Writer, cfg *Config) error {
+	redactedCfg := *cfg
+	for _, f := range collectFields(reflect.ValueOf(&redactedCfg).Elem(), "") {
+		if f.secret && !f.value.IsZero() {
+			f.value.SetString(redacted)
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	return encoder.Encode(redactedCfg)
+}
+
+type field struct {
+	path   string
+	env    string
+	def    string
+	secret bool
+	value  reflect.Value
+}
+
+// collectFields lists the leaf settings of the struct v, named by their yaml path.
+func collectFields(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		path := prefix + strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Time{}) {
+			fields = append(fields, collectFields(v.Field(i), path+".")...)
+			continue
+		}
+		fields = append(fields, field{
+			path:   path,
+			env:    sf.Tag.Get("env"),
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// setValue parses raw into v the way cleanenv parses environment variables:
+// lists are comma separated and maps are comma separated key:value pairs.
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		if raw != "" {
+			items = strings.Split(raw, ",")
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, pair := range strings.Split(raw, ",") {
+			if pair == "" {
+				continue
+			}
+			// Values never contain a colon, keys such as URIs may.
+			i := strings.LastIndex(pair, ":")
+			if i < 0 {
+				return fmt.Errorf("invalid map item %q", pair)
+			}
+			m[pair[:i]] = pair[i+1:]
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/secrets"
+	"golang.org/x/crypto/bcrypt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	logLevels      = []string{"debug", "info", "warn", "error"}
+	traceExporters = []string{"none", "stdout", "otlp"}
+	jwtAlgorithms  = []string{"HS256", "RS256", "EdDSA"}
+	authzScopes    = []string{"read", "write", "admin"}
+	// clientCertNames are the kinds of names client certificates are matched by.
+	clientCertNames = []string{"dn", "dns", "email", "uri"}
+	lockoutStores   = []string{"database", "memory"}
+	passwordHashes  = []string{"argon2id", "bcrypt"}
+	mailTransports  = []string{"none", "smtp", "file", "log"}
+)
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, path, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Database.Port)
+	check(err == nil && port > 0 && port < 65536, "database.port", "must be a port number, got %q", c.Database.Port)
+	check(c.Database.Host != "", "database.host", "must be set")
+	check(c.Database.Name != "", "database.name", "must be set")
+	check(c.Database.User != "", "database.user", "must be set")
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns", "must be positive")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns", "must be between 0 and max_open_conns (%d)", c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "must not be negative")
+
+	_, _, err = net.SplitHostPort(c.HTTPServer.Address)
+	check(err == nil, "http_server.address", "must be host:port, got %q", c.HTTPServer.Address)
+	check(c.HTTPServer.ReadTimeout > 0, "http_server.read_timeout", "must be positive")
+	check(c.HTTPServer.WriteTimeout > 0, "http_server.write_timeout", "must be positive")
+	check(c.HTTPServer.IdleTimeout > 0, "http_server.idle_timeout", "must be positive")
+	check(c.HTTPServer.MaxHeaderBytes > 0, "http_server.max_header_bytes", "must be positive")
+	check(c.HTTPServer.ShutdownTimeout > 0, "http_server.shutdown_timeout", "must be positive")
+	check((c.HTTPServer.TLSCertFile == "") == (c.HTTPServer.TLSKeyFile == ""),
+		"http_server.tls_cert_file", "must be set together with tls_key_file")
+	check(c.HTTPServer.TLSClientCAFile == "" || c.HTTPServer.TLSCertFile != "",
+		"http_server.tls_client_ca_file", "requires tls_cert_file and tls_key_file")
+	check(len(c.HTTPServer.TLSClientRoles) == 0 || c.HTTPServer.TLSClientCAFile != "",
+		"http_server.tls_client_roles", "requires tls_client_ca_file")
+	for name, role := range c.HTTPServer.TLSClientRoles {
+		kind, _, _ := strings.Cut(name, ":")
+		check(oneOf(kind, clientCertNames), "http_server.tls_client_roles", "name %q: must start with one of %v", name, clientCertNames)
+		_, ok := c.Authz.Roles[role]
+		check(ok, "http_server.tls_client_roles", "name %q: must map to one of the roles %v, got %q", name, c.Authz.RoleNames(), role)
+		// A client certificate cannot answer a one-time password.
+		check(!oneOf(role, c.Authz.MFARoles), "http_server.tls_client_roles", "name %q: role %q requires MFA in authz.mfa_roles", name, role)
+	}
+	check(c.HTTPServer.TLSReloadInterval > 0, "http_server.tls_reload_interval", "must be positive")
+
+	check(oneOf(c.JWT.Algorithm, jwtAlgorithms), "jwt.algorithm", "must be one of %v, got %q", jwtAlgorithms, c.JWT.Algorithm)
+	check(c.JWT.Algorithm != "HS256" || c.JWT.Secret != "", "jwt.secret", "must be set with the HS256 algorithm")
+	if c.JWT.Algorithm != "HS256" {
+		_, err := secrets.ParseKey(c.JWT.KeysEncryptionKey)
+		check(err == nil, "jwt.keys_encryption_key", "must be a valid key with the %s algorithm: %v", c.JWT.Algorithm, err)
+	}
+	check(c.JWT.KeysRefreshInterval > 0, "jwt.keys_refresh_interval", "must be positive")
+	check(c.JWT.Issuer != "", "jwt.issuer", "must be set")
+	check(c.JWT.Audience != "", "jwt.audience", "must be set")
+	check(c.JWT.AccessTTL > 0, "jwt.access_ttl", "must be positive")
+	check(c.JWT.RefreshTTL > c.JWT.AccessTTL, "jwt.refresh_ttl", "must be longer than access_ttl")
+	check(c.JWT.PruneInterval > 0, "jwt.prune_interval", "must be positive")
+
+	check(len(c.Authz.Roles) > 0, "authz.roles", "must grant scopes to at least one role")
+	for role, scopes := range c.Authz.Roles {
+		for _, scope := range strings.Fields(scopes) {
+			check(oneOf(scope, authzScopes), "authz.roles", "role %q: scope must be one of %v, got %q", role, authzScopes, scope)
+		}
+	}
+
+	_, ok := c.Authz.Roles[c.Authz.DefaultRole]
+	check(ok, "authz.default_role", "must be one of the roles %v, got %q", c.Authz.RoleNames(), c.Authz.DefaultRole)
+	for _, role := range c.Authz.MFARoles {
+		_, ok := c.Authz.Roles[role]
+		check(ok, "authz.mfa_roles", "must be one of the roles %v, got %q", c.Authz.RoleNames(), role)
+	}
+
+	if c.OIDC.Issuer != "" {
+		// Plain http is only good enough for a local mock issuer.
+		issuer, err := url.Parse(c.OIDC.Issuer)
+		check(err == nil && issuer.Host != "" && (issuer.Scheme == "https" || issuer.Scheme == "http" && c.Env == "local"),
+			"oidc.issuer", "must be an https URL, got %q", c.OIDC.Issuer)
+		check(c.OIDC.Audience != "", "oidc.audience", "must be set with oidc.issuer")
+		check(c.OIDC.UsernameClaim != "", "oidc.username_claim", "must be set with oidc.issuer")
+		for value, role := range c.OIDC.Roles {
+			_, ok := c.Authz.Roles[role]
+			check(ok, "oidc.roles", "value %q: must map to one of the roles %v, got %q", value, c.Authz.RoleNames(), role)
+			// Provider tokens are accepted without asking for a one-time password.
+			check(!oneOf(role, c.Authz.MFARoles), "oidc.roles", "value %q: role %q requires MFA in authz.mfa_roles", value, role)
+			check(len(c.OIDC.RolePrecedence) == 0 || oneOf(role, c.OIDC.RolePrecedence),
+				"oidc.role_precedence", "must list role %q of oidc.roles", role)
+		}
+		mapped := make(map[string]bool)
+		for _, role := range c.OIDC.Roles {
+			mapped[role] = true
+		}
+		check(len(mapped) <= 1 || len(c.OIDC.RolePrecedence) > 0, "oidc.role_precedence", "must be set when oidc.roles maps to several roles")
+		_, ok = c.Authz.Roles[c.OIDC.DefaultRole]
+		check(c.OIDC.DefaultRole == "" || ok, "oidc.default_role", "must be one of the roles %v, got %q", c.Authz.RoleNames(), c.OIDC.DefaultRole)
+		check(!oneOf(c.OIDC.DefaultRole, c.Authz.MFARoles), "oidc.default_role", "role %q requires MFA in authz.mfa_roles", c.OIDC.DefaultRole)
+	}
+
+	if c.Lockout.Enabled {
+		check(oneOf(c.Lockout.Store, lockoutStores), "lockout.store", "must be one of %v, got %q", lockoutStores, c.Lockout.Store)
+		check(c.Lockout.MaxUserFailures > 0, "lockout.max_user_failures", "must be positive")
+		check(c.Lockout.MaxClientFailures > 0, "lockout.max_client_failures", "must be positive")
+		check(c.Lockout.Duration > 0, "lockout.duration", "must be positive")
+		check(c.Lockout.BaseDelay > 0, "lockout.base_delay", "must be positive")
+		check(c.Lockout.MaxDelay >= c.Lockout.BaseDelay, "lockout.max_delay", "must not be shorter than base_delay")
+		check(c.Lockout.PruneInterval > 0, "lockout.prune_interval", "must be positive")
+	}
+
+	check(oneOf(c.Passwords.Algorithm, passwordHashes), "passwords.algorithm", "must be one of %v, got %q", passwordHashes, c.Passwords.Algorithm)
+	check(c.Passwords.BcryptCost >= bcrypt.MinCost && c.Passwords.BcryptCost <= bcrypt.MaxCost,
+		"passwords.bcrypt_cost", "must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Passwords.BcryptCost)
+	check(c.Passwords.Argon2Time > 0 && c.Passwords.Argon2Time <= math.MaxUint32, "passwords.argon2_time", "must be positive")
+	check(c.Passwords.Argon2Threads > 0 && c.Passwords.Argon2Threads <= math.MaxUint8, "passwords.argon2_threads", "must be between 1 and %d", math.MaxUint8)
+	check(c.Passwords.Argon2Memory >= 8*c.Passwords.Argon2Threads && c.Passwords.Argon2Memory <= math.MaxUint32,
+		"passwords.argon2_memory", "must be at least 8 KiB per thread")
+	check(c.Passwords.MinLength > 0, "passwords.min_length", "must be positive")
+	check(c.Passwords.MaxLength >= c.Passwords.MinLength, "passwords.max_length", "must not be shorter than min_length")
+
+	check(oneOf(c.Mail.Transport, mailTransports), "mail.transport", "must be one of %v, got %q", mailTransports, c.Mail.Transport)
+	if c.Mail.Transport != "none" {
+		check(c.Mail.Transport == "smtp" || c.Env == "local", "mail.transport", "must be smtp outside the local env, got %q", c.Mail.Transport)
+		_, err = mail.ParseAddress(c.Mail.From)
+		check(err == nil, "mail.from", "must be an email address, got %q", c.Mail.From)
+		if c.Mail.Transport == "smtp" {
+			_, _, err = net.SplitHostPort(c.Mail.SMTPAddress)
+			check(err == nil, "mail.smtp_address", "must be host:port, got %q", c.Mail.SMTPAddress)
+		}
+		check(c.Mail.Transport != "file" || c.Mail.File != "", "mail.file", "must be set with the file transport")
+		for path, page := range map[string]string{"mail.reset_url": c.Mail.ResetURL, "mail.verify_url": c.Mail.VerifyURL} {
+			u, err := url.Parse(page)
+			check(err == nil && u.IsAbs() && u.Host != "", path, "must be an absolute URL, got %q", page)
+		}
+		check(c.Mail.ResetTTL > 0, "mail.reset_ttl", "must be positive")
+		check(c.Mail.VerifyTTL > 0, "mail.verify_ttl", "must be positive")
+		check(c.Mail.PollInterval > 0, "mail.poll_interval", "must be positive")
+		check(c.Mail.SendTimeout > 0, "mail.send_timeout", "must be positive")
+		check(c.Mail.MaxAttempts > 0, "mail.max_attempts", "must be positive")
+		check(c.Mail.Retention > 0, "mail.retention", "must be positive")
+		check(c.Mail.PruneInterval > 0, "mail.prune_interval", "must be positive")
+	}
+
+	check(oneOf(c.Log.Level, logLevels), "log.level", "must be one of %v, got %q", logLevels, c.Log.Level)
+
+	check(c.CORS.MaxAge >= 0, "cors.max_age", "must not be negative")
+
+	check(c.RateLimit.Rate > 0, "rate_limit.rate", "must be positive")
+	check(c.RateLimit.Burst > 0, "rate_limit.burst", "must be positive")
+	check(c.RateLimit.ClientRate > 0, "rate_limit.client_rate", "must be positive")
+	check(c.RateLimit.ClientBurst > 0, "rate_limit.client_burst", "must be positive")
+	check(c.RateLimit.PruneInterval > 0, "rate_limit.prune_interval", "must be positive")
+	for role, value := range c.RateLimit.Roles {
+		_, ok := c.Authz.Roles[role]
+		check(ok, "rate_limit.roles", "must be one of the roles %v, got %q", c.Authz.RoleNames(), role)
+		_, err := parseLimit(value)
+		check(err == nil, "rate_limit.roles", "role %q: %v", role, err)
+	}
+	for route, value := range c.RateLimit.Routes {
+		method, path, _ := strings.Cut(route, " ")
+		check(method != "" && strings.HasPrefix(path, "/"), "rate_limit.routes", "must be a method and a path, got %q", route)
+		_, err := parseLimit(value)
+		check(err == nil, "rate_limit.routes", "route %q: %v", route, err)
+	}
+
+	check(c.Cache.Size >= 0, "cache.size", "must not be negative")
+	check(c.Cache.TTL > 0, "cache.ttl", "must be positive")
+
+	check(oneOf(c.Tracing.Exporter, traceExporters), "tracing.exporter", "must be one of %v, got %q", traceExporters, c.Tracing.Exporter)
+
+	check(c.Secrets.File == "" || c.Secrets.Key != "", "secrets.key", "must be set with secrets.file")
+	check(c.Secrets.RefreshInterval >= 0, "secrets.refresh_interval", "must not be negative")
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,57 @@
 package database
 
+import (
+	"errors"
+	"time"
+)
+
+// ChangesChannel is the notification channel write operations are announced on.
+// The payload is the name of the changed entity.
+const ChangesChannel = "filmbase_changes"
+
+const (
+	EntityActor     = "actor"
+	EntityFilm      = "film"
+	EntityActorFilm = "actor_film"
+	// EntityRevocation is announced when access tokens are revoked.
+	EntityRevocation = "revocation"
+)
+
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenExpired  = errors.New("refresh token expired")
+	// ErrTokenReused is returned when a refresh token is presented again after
+	// it was rotated, in which case every token of its family is revoked.
+	ErrTokenReused  = errors.New("refresh token reused")
+	ErrUserNotFound = NotFound("user not found")
+	ErrKeyNotFound  = NotFound("signing key not found")
+	// ErrLastSigningKey is returned rather than retiring the only key that
+	// signs tokens, not counting the keys that do not sign yet.
+	ErrLastSigningKey = Conflict("cannot retire the last active signing key, generate another one first")
+	ErrAPIKeyNotFound = NotFound("api key not found")
+	// ErrUserConflict is returned when a user is provisioned under the name of
+	// a user of another provider.
+	ErrUserConflict = Conflict("user belongs to another provider")
+	// ErrUserProvisioned is returned when changing the role of a user of an
+	// external provider, which sets it again on the next login.
+	ErrUserProvisioned = Conflict("role of the user is set by its identity provider")
+	// ErrUserTokenInvalid is returned for a mailed token that was never
+	// issued, expired or was already used.
+	ErrUserTokenInvalid = errors.New("token is invalid, expired or used")
+	// ErrMFANotEnrolled is returned when a user has no TOTP secret, or has not
+	// confirmed it where a confirmed one is required.
+	ErrMFANotEnrolled = NotFound("two-factor authentication not enrolled")
+	ErrMFAEnrolled    = Conflict("two-factor authentication already enrolled")
+	// ErrOTPInvalid is returned for a one-time password or recovery code that
+	// was already used or never issued.
+	ErrOTPInvalid = errors.New("one-time password is invalid or used")
+)
+
 type FilmbaseRepository interface {
+	Ping() error
 	RunMigrations(query ...string)
+	// MigrationVersion returns the applied and the expected schema version.
+	MigrationVersion() (int, int, error)
 	PostActor(actor Actor) (int64, error)
 	PutActor(actor Actor) error
 	DeleteActorById(actorId int64) error
@@ -12,39 +62,245 @@ type FilmbaseRepository interface {
 	PostFilm(film Film) (int64, error)
 	PutFilm(film Film) error
 	DeleteFilmById(filmId int64) error
-	Login(username string, password string) (string, error)
-	Signup(username string, password string) error
+	// UserCredentials returns the local user username with the hash of their
+	// password, ErrUserNotFound when no such user may log in.
+	UserCredentials(username string) (User, error)
+	SetUserPassword(username string, hash string) error
+	// Signup creates the local user username, with email unless it is empty.
+	Signup(username string, password string, role string, email string) error
+	// UserByEmail returns the local user with email, ErrUserNotFound when no
+	// such user may log in.
+	UserByEmail(email string) (User, error)
+	ListUsers() ([]User, error)
+	// SetUserRole changes the role of a local user, ErrUserProvisioned for a
+	// user of an external provider.
+	SetUserRole(username string, role string) error
+	// SetUserDisabled disables or enables username. Disabled users cannot log in.
+	SetUserDisabled(username string, disabled bool) error
+	DeleteUser(username string) error
+	// CreateRefreshToken stores a refresh token starting or continuing a family.
+	CreateRefreshToken(token RefreshToken) error
+	// RotateRefreshToken spends the refresh token stored under hash and stores
+	// next in its family, returning the user the token belongs to. It returns
+	// ErrUserNotFound when the user was deleted or disabled.
+	RotateRefreshToken(hash string, next RefreshToken) (User, error)
+	// RevokeRefreshToken revokes the family of the refresh token stored under
+	// hash if it belongs to username.
+	RevokeRefreshToken(hash string, username string) error
+	// RevokeToken revokes the access token jti until it expires.
+	RevokeToken(jti string, expiresAt time.Time) error
+	// RevokeUserTokens revokes every access and refresh token issued to username so far.
+	RevokeUserTokens(username string) error
+	// IsTokenRevoked reports whether the access token jti issued to username at
+	// issuedAt was revoked, or username was disabled or deleted since.
+	IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error)
+	// PruneTokens deletes expired refresh tokens, revocations and mailed tokens,
+	// returning how many were deleted.
+	PruneTokens() (int64, error)
+	// SigningKeys returns every signing key that was not retired before retiredAfter.
+	SigningKeys(retiredAfter time.Time) ([]SigningKey, error)
+	CreateSigningKey(key SigningKey) error
+	// CreateFirstSigningKey creates key unless a key that is not retired exists,
+	// so that instances starting together on an empty database create a single key.
+	CreateFirstSigningKey(key SigningKey) (created bool, err error)
+	// UpdateSigningKey replaces the stored private key of the key id.
+	UpdateSigningKey(id string, privateKey []byte) error
+	// RetireSigningKey stops signing with the key id. Its tokens are still verified until they expire.
+	// The last key that signs tokens is never retired.
+	RetireSigningKey(id string) error
+	CreateAPIKey(key APIKey) error
+	ListAPIKeys() ([]APIKey, error)
+	// APIKey returns the API key identified by prefix.
+	APIKey(prefix string) (APIKey, error)
+	// TouchAPIKey records that the API key identified by prefix was used.
+	TouchAPIKey(prefix string) error
+	DeleteAPIKey(prefix string) error
+	// ProvisionUser creates the user username of provider with role, or updates
+	// the role of an existing one, and returns it.
+	ProvisionUser(username string, provider string, role string) (User, error)
+	// RecordLoginAttempt counts a login attempt of key at at as failed until it
+	// succeeds, forgetting the failures until since, and returns the attempts of
+	// key including it. Concurrent attempts each see those recorded before them.
+	RecordLoginAttempt(key string, at time.Time, since time.Time) (LoginAttempts, error)
+	// ForgiveLoginAttempt takes back the last attempt of key, which succeeded.
+	ForgiveLoginAttempt(key string) error
+	ResetLoginAttempts(key string) error
+	// PruneLoginAttempts deletes the attempts whose last failure was until before.
+	PruneLoginAttempts(before time.Time) (int64, error)
+	// AuditFailedLogin keeps a record of a failed login.
+	AuditFailedLogin(login FailedLogin) error
+	// CreateUserToken stores token and queues mail in the outbox at once, so
+	// that no token is mailed without being stored.
+	CreateUserToken(token UserToken, mail Mail) error
+	// UserToken returns the token of purpose stored under hash,
+	// ErrUserTokenInvalid unless it may still be used.
+	UserToken(hash string, purpose string) (UserToken, error)
+	// ResetPassword spends the password reset token stored under hash and
+	// sets the password of its user to password, returning the user.
+	ResetPassword(hash string, password string) (User, error)
+	// VerifyEmail spends the email verification token stored under hash and
+	// marks the email it was mailed to as verified, returning the user.
+	VerifyEmail(hash string) (User, error)
+	// ClaimMail returns up to limit messages due to be sent and holds them for
+	// lease, so that several instances do not send the same message. Messages
+	// neither marked sent nor failed within lease are claimed again.
+	ClaimMail(limit int, lease time.Duration) ([]Mail, error)
+	MarkMailSent(id int64) error
+	// MarkMailFailed records a failed attempt to send message id, which is
+	// attempted again at retryAt, never when nil.
+	MarkMailFailed(id int64, reason string, retryAt *time.Time) error
+	// PruneMail deletes the messages queued until before that were sent or
+	// given up on.
+	PruneMail(before time.Time) (int64, error)
+	// TOTP returns the TOTP secret of username, ErrMFANotEnrolled when there is none.
+	TOTP(username string) (TOTP, error)
+	// BeginTOTP stores the unconfirmed secret of username, replacing a previous
+	// unconfirmed one, ErrMFAEnrolled when a confirmed one exists.
+	BeginTOTP(username string, secret string) error
+	// ConfirmTOTP confirms the secret of username, whose code of step was
+	// presented, and replaces the recovery codes of username with hashes.
+	ConfirmTOTP(username string, step int64, hashes []string) error
+	// UseTOTPStep records that the code of step was presented by username,
+	// ErrOTPInvalid when a code of that step or a later one was presented before.
+	UseTOTPStep(username string, step int64) error
+	// UseRecoveryCode spends the recovery code of username stored under hash,
+	// ErrOTPInvalid when there is none.
+	UseRecoveryCode(username string, hash string) error
+	// SetRecoveryCodes replaces the recovery codes of username with hashes.
+	SetRecoveryCodes(username string, hashes []string) error
+	// DeleteTOTP deletes the TOTP secret and recovery codes of username.
+	DeleteTOTP(username string) error
 }
 
 type Actor struct {
-	Id        int64  `db:"id" required:"true"`
-	Name      string `db:"name" required:"true"`
-	Gender    string `db:"gender" required:"true"`
-	Birthdate string `db:"birthdate" required:"true"`
+	Id        int64     `db:"id" required:"true"`
+	Name      string    `db:"name" required:"true"`
+	Gender    string    `db:"gender" required:"true"`
+	Birthdate time.Time `db:"birthdate" required:"true"`
 }
 
 type Film struct {
-	Id          int64  `db:"id" required:"true"`
-	Name        string `db:"name" required:"true"`
-	Description string `db:"description" required:"true"`
-	ReleaseDate string `db:"release_date" required:"true"`
-	Rating      int    `db:"rating" required:"true"`
+	Id          int64     `db:"id" required:"true"`
+	Name        string    `db:"name" required:"true"`
+	Description string    `db:"description" required:"true"`
+	ReleaseDate time.Time `db:"release_date" required:"true"`
+	Rating      int       `db:"rating" required:"true"`
 }
 
 type ActorFilm struct {
-	ActorId         int64  `db:"actor_id" required:"true"`
-	ActorName       string `db:"actor_name" required:"true"`
-	ActorGender     string `db:"actor_gender" required:"true"`
-	ActorBirthdate  string `db:"actor_birthdate" required:"true"`
-	FilmId          int64  `db:"film_id" required:"true"`
-	FilmName        string `db:"film_name" required:"true"`
-	FilmDescription string `db:"film_descr" required:"true"`
-	FilmReleaseDate string `db:"film_release_date" required:"true"`
-	FilmRating      int    `db:"film_rating" required:"true"`
+	ActorId         int64     `db:"actor_id" required:"true"`
+	ActorName       string    `db:"actor_name" required:"true"`
+	ActorGender     string    `db:"actor_gender" required:"true"`
+	ActorBirthdate  time.Time `db:"actor_birthdate" required:"true"`
+	FilmId          int64     `db:"film_id" required:"true"`
+	FilmName        string    `db:"film_name" required:"true"`
+	FilmDescription string    `db:"film_descr" required:"true"`
+	FilmReleaseDate time.Time `db:"film_release_date" required:"true"`
+	FilmRating      int       `db:"film_rating" required:"true"`
 }
 
 type User struct {
 	Username string `db:"username" required:"true"`
 	Password string `db:"password" required:"true"`
 	Role     string `db:"role" required:"true"`
+	Disabled bool   `db:"disabled"`
+	// Provider is the identity provider of the user, LocalProvider for users
+	// with a password.
+	Provider      string `db:"provider"`
+	Email         string `db:"email"`
+	EmailVerified bool   `db:"email_verified"`
+}
+
+// LocalProvider is the provider of users that log in with a password.
+const LocalProvider = "local"
+
+// RefreshToken is a stored refresh token. Tokens rotated from one another share
+// their Family.
+type RefreshToken struct {
+	Hash      string    `db:"token_hash"`
+	Family    string    `db:"family"`
+	Username  string    `db:"username"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// SigningKey is a key access tokens are signed with. PrivateKey is PEM encoded
+// PKCS #8, stored encrypted. The key is published as soon as it is created but
+// only signs from NotBefore on.
+type SigningKey struct {
+	ID         string     `db:"kid"`
+	Algorithm  string     `db:"algorithm"`
+	PrivateKey []byte     `db:"private_key"`
+	CreatedAt  time.Time  `db:"created_at"`
+	NotBefore  time.Time  `db:"not_before"`
+	RetiredAt  *time.Time `db:"retired_at"`
+}
+
+// APIKey is a key service accounts authenticate with. Only the hash of the key
+// is stored, its Prefix identifies it.
+type APIKey struct {
+	Prefix string `db:"prefix"`
+	Hash   string `db:"key_hash"`
+	Name   string `db:"name"`
+	Role   string `db:"role"`
+	// Scopes are the space separated scopes the key is restricted to, all the
+	// scopes of Role when empty.
+	Scopes     string     `db:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// LoginAttempts are the consecutive failed logins of a username or a client.
+// PreviousFailure is the failure before LastFailure, if any.
+type LoginAttempts struct {
+	Failures        int       `db:"failures"`
+	LastFailure     time.Time `db:"last_failure"`
+	PreviousFailure time.Time `db:"previous_failure"`
+}
+
+// FailedLogin is the audit record of a failed login.
+type FailedLogin struct {
+	Username string    `db:"username"`
+	ClientIP string    `db:"client_ip"`
+	Reason   string    `db:"reason"`
+	At       time.Time `db:"at"`
+}
+
+// Purposes of user tokens.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use token mailed to a user, e.g. to reset their
+// password. Only the hash of the token is stored.
+type UserToken struct {
+	Hash     string `db:"token_hash"`
+	Username string `db:"username"`
+	Purpose  string `db:"purpose"`
+	// Email is the address the token was mailed to.
+	Email     string    `db:"email"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// Mail is a message in the outbox.
+type Mail struct {
+	ID        int64  `db:"id"`
+	Recipient string `db:"recipient"`
+	Subject   string `db:"subject"`
+	Body      string `db:"body"`
+	// Attempts is the number of failed attempts to send the message.
+	Attempts int `db:"attempts"`
+}
+
+// TOTP is the secret a user generates time-based one-time passwords with.
+type TOTP struct {
+	Username string `db:"username"`
+	Secret   string `db:"secret"`
+	// Confirmed is set once the user presented a code of the secret, only
+	// then are they asked for codes at login.
+	Confirmed bool `db:"confirmed"`
+	// LastStep is the time step of the last code presented, so that no code
+	// is accepted twice.
+	LastStep int64 `db:"last_step"`
 }
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors. A domain error is errors.Is its kind, so that
+// callers tell them apart without knowing every error of a kind.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+	ErrForbidden  = errors.New("forbidden")
+)
+
+// FieldError is a problem with a single field of an entity.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error of Kind, one of ErrNotFound, ErrConflict,
+// ErrValidation or ErrForbidden. Its message is safe to show to clients.
+type Error struct {
+	Kind    error
+	Message string
+	// Fields are the fields at fault, if any.
+	Fields []FieldError
+	// Err is the cause, if any. It is not shown to clients.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors returns the fields at fault.
+func (e *Error) FieldErrors() []FieldError {
+	return e.Fields
+}
+
+func NotFound(format string, args ...any) *Error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...any) *Error {
+	return &Error{Kind: ErrConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func Forbidden(format string, args ...any) *Error {
+	return &Error{Kind: ErrForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// Invalid returns a validation error of fields.
+func Invalid(fields ...FieldError) *Error {
+	return &Error{Kind: ErrValidation, Message: ErrValidation.Error(), Fields: fields}
+}
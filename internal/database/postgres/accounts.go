@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+func (d *Database) UserByEmail(email string) (database.User, error) {
+	var user database.User
+	err := d.db.Get(&user, `
+		SELECT username, COALESCE(role, '') AS role, provider, email, email_verified FROM api_users
+		WHERE email = $1 AND provider = $2 AND NOT disabled`, email, database.LocalProvider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, database.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (d *Database) CreateUserToken(token database.UserToken, mail database.Mail) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO user_tokens (token_hash, username, purpose, email, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		token.Hash, token.Username, token.Purpose, token.Email, token.ExpiresAt); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("INSERT INTO outbox (recipient, subject, body) VALUES ($1, $2, $3)",
+		mail.Recipient, mail.Subject, mail.Body); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) UserToken(hash string, purpose string) (database.UserToken, error) {
+	var token database.UserToken
+	err := d.db.Get(&token, `
+		SELECT token_hash, username, purpose, email, expires_at FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()`, hash, purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, database.ErrUserTokenInvalid
+	}
+	return token, err
+}
+
+// ResetPassword spends every other reset token of the user as well, so that
+// an older mail cannot undo the reset.
+func (d *Database) ResetPassword(hash string, password string) (database.User, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	token, err := spendUserToken(tx, hash, database.PurposePasswordReset)
+	if err != nil {
+		return database.User{}, err
+	}
+	var user database.User
+	err = tx.Get(&user, `
+		UPDATE api_users SET password = $2 WHERE username = $1 AND provider = $3 AND NOT disabled
+		RETURNING username, COALESCE(role, '') AS role, provider, COALESCE(email, '') AS email, email_verified`,
+		token.Username, password, database.LocalProvider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, database.ErrUserTokenInvalid
+	}
+	if err != nil {
+		return user, err
+	}
+	if _, err = tx.Exec("UPDATE user_tokens SET used_at = now() WHERE username = $1 AND purpose = $2 AND used_at IS NULL",
+		token.Username, database.PurposePasswordReset); err != nil {
+		return user, err
+	}
+	return user, tx.Commit()
+}
+
+// VerifyEmail only verifies the email the token was mailed to, a token mailed
+// before the email of the user changed is invalid.
+func (d *Database) VerifyEmail(hash string) (database.User, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	token, err := spendUserToken(tx, hash, database.PurposeEmailVerification)
+	if err != nil {
+		return database.User{}, err
+	}
+	var user database.User
+	err = tx.Get(&user, `
+		UPDATE api_users SET email_verified = true WHERE username = $1 AND email = $2
+		RETURNING username, COALESCE(role, '') AS role, provider, email, email_verified`,
+		token.Username, token.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, database.ErrUserTokenInvalid
+	}
+	if err != nil {
+		return user, err
+	}
+	return user, tx.Commit()
+}
+
+// spendUserToken marks the token of purpose stored under hash used, so that
+// of two concurrent uses only one succeeds.
+func spendUserToken(tx *sqlx.Tx, hash string, purpose string) (database.UserToken, error) {
+	var token database.UserToken
+	err := tx.Get(&token, `
+		UPDATE user_tokens SET used_at = now()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+		RETURNING token_hash, username, purpose, email, expires_at`, hash, purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		return token, database.ErrUserTokenInvalid
+	}
+	return token, err
+}
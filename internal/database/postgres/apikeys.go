@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+)
+
+// apiKeyUseResolution is how stale the last use of an API key may get, so that
+// not every request writes it.
+const apiKeyUseResolution = "1 minute"
+
+func (d *Database) CreateAPIKey(key database.APIKey) error {
+	_, err := d.db.Exec("INSERT INTO api_keys (prefix, key_hash, name, role, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		key.Prefix, key.Hash, key.Name, key.Role, key.Scopes, key.ExpiresAt)
+	return err
+}
+
+func (d *Database) ListAPIKeys() ([]database.APIKey, error) {
+	var keys []database.APIKey
+	err := d.db.Select(&keys, "SELECT prefix, name, role, scopes, expires_at, last_used_at, created_at FROM api_keys ORDER BY name")
+	return keys, err
+}
+
+func (d *Database) APIKey(prefix string) (database.APIKey, error) {
+	var key database.APIKey
+	err := d.db.Get(&key, "SELECT prefix, key_hash, name, role, scopes, expires_at, last_used_at, created_at FROM api_keys WHERE prefix = $1", prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, database.ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (d *Database) TouchAPIKey(prefix string) error {
+	_, err := d.db.Exec(`
+		UPDATE api_keys SET last_used_at = now()
+		WHERE prefix = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '`+apiKeyUseResolution+`')`, prefix)
+	return err
+}
+
+func (d *Database) DeleteAPIKey(prefix string) error {
+	result, err := d.db.Exec("DELETE FROM api_keys WHERE prefix = $1", prefix)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return database.ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strings"
+)
+
+// SQLSTATE codes of errors caused by what was written rather than by the
+// database, see https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	notNullViolation    = "23502"
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+	checkViolation      = "23514"
+	// dataException is the class of invalid values, e.g. malformed dates or
+	// numbers out of range.
+	dataException = "22"
+)
+
+// translate returns the domain error err stands for when entity was written,
+// err when it is not caused by what was written.
+func translate(err error, entity string) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	var e *database.Error
+	switch {
+	case pgErr.Code == uniqueViolation:
+		e = database.Conflict("%s already exists", entity)
+		e.Fields = constraintFields(pgErr, "_key", "already taken")
+	case pgErr.Code == foreignKeyViolation:
+		e = database.NotFound("%s refers to an entity that does not exist", entity)
+	case pgErr.Code == notNullViolation:
+		e = database.Invalid(database.FieldError{Field: pgErr.ColumnName, Message: "is required"})
+	case pgErr.Code == checkViolation:
+		e = database.Invalid(constraintFields(pgErr, "_check", "is out of range")...)
+	case strings.HasPrefix(pgErr.Code, dataException):
+		e = database.Invalid()
+		e.Message = pgErr.Message
+	default:
+		return err
+	}
+	e.Err = err
+	return e
+}
+
+// translateDelete is translate for a deleted entity, which conflicts with the
+// entities still referring to it.
+func translateDelete(err error, entity string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		e := database.Conflict("%s is still referred to", entity)
+		e.Err = err
+		return e
+	}
+	return translate(err, entity)
+}
+
+// constraintFields returns the field constrained by the constraint of pgErr,
+// going by the default constraint names such as film_rating_check. Primary
+// keys are named table_pkey and constrain the id or the name.
+func constraintFields(pgErr *pgconn.PgError, suffix, message string) []database.FieldError {
+	field := pgErr.ColumnName
+	if field == "" {
+		name := strings.TrimPrefix(pgErr.ConstraintName, pgErr.TableName+"_")
+		if name == "pkey" {
+			return nil
+		}
+		field = strings.TrimSuffix(name, suffix)
+	}
+	if field == "" {
+		return nil
+	}
+	return []database.FieldError{{Field: field, Message: message}}
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+func (d *Database) SigningKeys(retiredAfter time.Time) ([]database.SigningKey, error) {
+	var keys []database.SigningKey
+	err := d.db.Select(&keys, `
+		SELECT kid, algorithm, private_key, created_at, not_before, retired_at FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > $1 ORDER BY created_at`, retiredAfter)
+	return keys, err
+}
+
+func (d *Database) CreateSigningKey(key database.SigningKey) error {
+	_, err := d.db.Exec("INSERT INTO signing_keys (kid, algorithm, private_key, not_before) VALUES ($1, $2, $3, $4)",
+		key.ID, key.Algorithm, key.PrivateKey, key.NotBefore)
+	return err
+}
+
+func (d *Database) CreateFirstSigningKey(key database.SigningKey) (bool, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	// The lock is held until the transaction ends, so that the instances
+	// waiting for it see the key it created.
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", signingKeysLock); err != nil {
+		return false, err
+	}
+	var exists bool
+	if err = tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM signing_keys WHERE retired_at IS NULL)"); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	if _, err = tx.Exec("INSERT INTO signing_keys (kid, algorithm, private_key, not_before) VALUES ($1, $2, $3, $4)",
+		key.ID, key.Algorithm, key.PrivateKey, key.NotBefore); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (d *Database) UpdateSigningKey(id string, privateKey []byte) error {
+	result, err := d.db.Exec("UPDATE signing_keys SET private_key = $2 WHERE kid = $1", id, privateKey)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return database.ErrKeyNotFound
+	}
+	return nil
+}
+
+func (d *Database) RetireSigningKey(id string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Locking the active keys keeps two retirements from retiring them all.
+	var active []struct {
+		ID      string `db:"kid"`
+		Signing bool   `db:"signing"`
+	}
+	if err = tx.Select(&active, "SELECT kid, not_before <= now() AS signing FROM signing_keys WHERE retired_at IS NULL FOR UPDATE"); err != nil {
+		return err
+	}
+	found, retiringSigning, signing := false, false, 0
+	for _, k := range active {
+		if k.ID == id {
+			found, retiringSigning = true, k.Signing
+		}
+		if k.Signing {
+			signing++
+		}
+	}
+	if !found {
+		return database.ErrKeyNotFound
+	}
+	if retiringSigning && signing == 1 {
+		return database.ErrLastSigningKey
+	}
+	if _, err = tx.Exec("UPDATE signing_keys SET retired_at = now() WHERE kid = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
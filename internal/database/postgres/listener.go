@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"log/slog"
+	"time"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Listener receives notifications on a dedicated connection, outside of the
+// sqlx pool, and reconnects whenever the connection is lost.
+type Listener struct {
+	db      *Database
+	channel string
+	logger  *slog.Logger
+}
+
+// NewListener returns a listener on channel connecting with the settings and
+// the current password of d.
+func (d *Database) NewListener(channel string, logger *slog.Logger) *Listener {
+	return &Listener{
+		db:      d,
+		channel: channel,
+		logger:  logger,
+	}
+}
+
+// Listen calls notify with the payload of every notification until ctx is done.
+// Notifications sent while the connection was down are lost, so reconnected is
+// called after every successful reconnect to let the caller resynchronise.
+func (l *Listener) Listen(ctx context.Context, notify func(payload string), reconnected func()) {
+	delay := minReconnectDelay
+	connected := false
+	for {
+		err := l.listen(ctx, notify, func() {
+			if connected {
+				reconnected()
+			}
+			connected = true
+			delay = minReconnectDelay
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Error(fmt.Sprintf("Listener on %s lost connection, reconnecting in %s: %s", l.channel, delay, err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context, notify func(payload string), connected func()) error {
+	connConfig := l.db.connConfig.Copy()
+	connConfig.Password = l.db.currentPassword()
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize())
+	if err != nil {
+		return err
+	}
+	l.logger.Debug(fmt.Sprintf("Listening on %s", l.channel))
+	connected()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		notify(n.Payload)
+	}
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// Keys of the advisory locks serializing the work that instances sharing the
+// database must not do at the same time.
+const (
+	migrationsLock  int64 = 0x66696c6d0001
+	signingKeysLock int64 = 0x66696c6d0002
+)
+
+// withLock runs fn on a connection holding the advisory lock key, waiting for
+// the instance holding it, if any, to be done.
+func (d *Database) withLock(key int64, fn func(conn *sqlx.Conn) error) error {
+	ctx := context.Background()
+	conn, err := d.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		return fmt.Errorf("taking advisory lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+			// The connection is discarded rather than pooled with the lock,
+			// ending the session releases it.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+	return fn(conn)
+}
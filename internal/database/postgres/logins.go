@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+// RecordLoginAttempt counts the attempt in a single statement, so that
+// concurrent guesses are all counted and each sees those before it.
+func (d *Database) RecordLoginAttempt(key string, at time.Time, since time.Time) (database.LoginAttempts, error) {
+	var attempts database.LoginAttempts
+	err := d.db.Get(&attempts, `
+		INSERT INTO login_attempts (key, failures, last_failure, previous_failure) VALUES ($1, 1, $2, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure <= $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			previous_failure = login_attempts.last_failure,
+			last_failure = excluded.last_failure
+		RETURNING failures, last_failure, previous_failure`, key, at, since)
+	return attempts, err
+}
+
+func (d *Database) ForgiveLoginAttempt(key string) error {
+	_, err := d.db.Exec(`
+		UPDATE login_attempts SET failures = greatest(failures - 1, 0), last_failure = previous_failure
+		WHERE key = $1`, key)
+	return err
+}
+
+func (d *Database) ResetLoginAttempts(key string) error {
+	_, err := d.db.Exec("DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
+
+func (d *Database) PruneLoginAttempts(before time.Time) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM login_attempts WHERE last_failure <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (d *Database) AuditFailedLogin(login database.FailedLogin) error {
+	_, err := d.db.Exec("INSERT INTO failed_logins (username, client_ip, reason, at) VALUES ($1, $2, $3, $4)",
+		login.Username, login.ClientIP, login.Reason, login.At)
+	return err
+}
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+func (d *Database) TOTP(username string) (database.TOTP, error) {
+	var totp database.TOTP
+	err := d.db.Get(&totp, "SELECT username, secret, confirmed, last_step FROM totp WHERE username = $1", username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return totp, database.ErrMFANotEnrolled
+	}
+	return totp, err
+}
+
+func (d *Database) BeginTOTP(username string, secret string) error {
+	res, err := d.db.Exec(`
+		INSERT INTO totp (username, secret) VALUES ($1, $2)
+		ON CONFLICT (username) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = now()
+		WHERE NOT totp.confirmed`, username, secret)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrMFAEnrolled
+	}
+	return nil
+}
+
+// ConfirmTOTP only confirms a secret that is not confirmed yet, so that of two
+// concurrent confirmations only one hands out recovery codes.
+func (d *Database) ConfirmTOTP(username string, step int64, hashes []string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE totp SET confirmed = true, last_step = $2 WHERE username = $1 AND NOT confirmed AND last_step < $2",
+		username, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrOTPInvalid
+	}
+	if err = setRecoveryCodes(tx, username, hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) UseTOTPStep(username string, step int64) error {
+	res, err := d.db.Exec("UPDATE totp SET last_step = $2 WHERE username = $1 AND confirmed AND last_step < $2",
+		username, step)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrOTPInvalid
+	}
+	return nil
+}
+
+func (d *Database) UseRecoveryCode(username string, hash string) error {
+	res, err := d.db.Exec("DELETE FROM recovery_codes WHERE username = $1 AND code_hash = $2", username, hash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrOTPInvalid
+	}
+	return nil
+}
+
+func (d *Database) SetRecoveryCodes(username string, hashes []string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = setRecoveryCodes(tx, username, hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) DeleteTOTP(username string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM totp WHERE username = $1", username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrMFANotEnrolled
+	}
+	if _, err = tx.Exec("DELETE FROM recovery_codes WHERE username = $1", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRecoveryCodes(tx *sqlx.Tx, username string, hashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE username = $1", username); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (code_hash, username) VALUES ($1, $2)", hash, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations are applied in order, the schema version is the number of
+// migrations applied. Never edit or reorder released migrations, append new ones.
+var migrations = []string{
+	`
+	CREATE TABLE IF NOT EXISTS film (
+		id serial PRIMARY KEY,
+		name varchar CHECK(char_length(name) > 1),
+		description varchar CHECK ( char_length(name) > 1 AND char_length(name) < 1000 ),
+		rating smallint CHECK (rating IN (0,1,2,3,4,5,6,7,8,9,10)),
+		release_date date
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS actor (
+		id serial PRIMARY KEY,
+		name varchar CHECK(char_length(name) > 1),
+		gender varchar CHECK(gender IN ('male', 'female')),
+		birthdate date
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS actor_films (
+		actorid int REFERENCES actor(id),
+		filmid int REFERENCES film(id),
+		PRIMARY KEY (actorid, filmid)
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS api_users (
+		username varchar PRIMARY KEY,
+		password varchar,
+		role varchar
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		token_hash varchar PRIMARY KEY,
+		family uuid NOT NULL,
+		username varchar NOT NULL REFERENCES api_users(username) ON DELETE CASCADE,
+		expires_at timestamptz NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT now(),
+		used_at timestamptz,
+		revoked_at timestamptz
+	);
+	CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti varchar PRIMARY KEY,
+		expires_at timestamptz NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS user_revocations (
+		username varchar PRIMARY KEY REFERENCES api_users(username) ON DELETE CASCADE,
+		revoked_before timestamptz NOT NULL
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		kid varchar PRIMARY KEY,
+		algorithm varchar NOT NULL,
+		private_key bytea NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT now(),
+		retired_at timestamptz
+	)
+`,
+	`
+	ALTER TABLE api_users ADD COLUMN IF NOT EXISTS disabled boolean NOT NULL DEFAULT false
+`,
+	`
+	CREATE TABLE IF NOT EXISTS api_keys (
+		prefix varchar PRIMARY KEY,
+		key_hash varchar NOT NULL,
+		name varchar NOT NULL UNIQUE,
+		role varchar NOT NULL,
+		scopes varchar NOT NULL DEFAULT '',
+		expires_at timestamptz,
+		last_used_at timestamptz,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)
+`,
+	`
+	ALTER TABLE api_users ADD COLUMN IF NOT EXISTS provider varchar NOT NULL DEFAULT 'local'
+`,
+	`
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		key varchar PRIMARY KEY,
+		failures integer NOT NULL,
+		last_failure timestamptz NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS failed_logins (
+		id bigserial PRIMARY KEY,
+		username varchar NOT NULL,
+		client_ip varchar NOT NULL,
+		reason varchar NOT NULL,
+		at timestamptz NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS failed_logins_username_idx ON failed_logins (username, at)
+`,
+	`
+	ALTER TABLE api_users ADD COLUMN IF NOT EXISTS email varchar UNIQUE;
+	ALTER TABLE api_users ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		token_hash varchar PRIMARY KEY,
+		username varchar NOT NULL REFERENCES api_users(username) ON DELETE CASCADE,
+		purpose varchar NOT NULL,
+		email varchar NOT NULL,
+		expires_at timestamptz NOT NULL,
+		created_at timestamptz NOT NULL DEFAULT now(),
+		used_at timestamptz
+	);
+	CREATE TABLE IF NOT EXISTS outbox (
+		id bigserial PRIMARY KEY,
+		recipient varchar NOT NULL,
+		subject varchar NOT NULL,
+		body text NOT NULL,
+		attempts integer NOT NULL DEFAULT 0,
+		last_error varchar,
+		next_attempt_at timestamptz DEFAULT now(),
+		created_at timestamptz NOT NULL DEFAULT now(),
+		sent_at timestamptz
+	);
+	CREATE INDEX IF NOT EXISTS outbox_due_idx ON outbox (next_attempt_at) WHERE next_attempt_at IS NOT NULL
+`,
+	// 13: TOTP two-factor authentication and recovery codes.
+	`
+	CREATE TABLE IF NOT EXISTS totp (
+		username varchar PRIMARY KEY REFERENCES api_users (username) ON DELETE CASCADE,
+		secret varchar NOT NULL,
+		confirmed boolean NOT NULL DEFAULT false,
+		last_step bigint NOT NULL DEFAULT 0,
+		created_at timestamptz NOT NULL DEFAULT now()
+	);
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		code_hash varchar PRIMARY KEY,
+		username varchar NOT NULL REFERENCES api_users (username) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS recovery_codes_username_idx ON recovery_codes (username)
+`,
+	// 14: signing keys only sign once every instance had the time to load them.
+	`
+	ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS not_before timestamptz NOT NULL DEFAULT now()
+`,
+	// 15: login attempts are counted before they are verified and taken back
+	// when they succeed, restoring the failure before them.
+	`
+	ALTER TABLE login_attempts ADD COLUMN IF NOT EXISTS previous_failure timestamptz;
+	UPDATE login_attempts SET previous_failure = last_failure WHERE previous_failure IS NULL;
+	ALTER TABLE login_attempts ALTER COLUMN previous_failure SET NOT NULL
+`,
+}
+
+const migrationsTableDDL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version int PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)
+`
+
+// Migrate applies every pending migration, each in its own transaction. The
+// migrations lock keeps instances started together from applying them twice.
+func (d *Database) Migrate() error {
+	return d.withLock(migrationsLock, func(conn *sqlx.Conn) error {
+		ctx := context.Background()
+		if _, err := conn.ExecContext(ctx, migrationsTableDDL); err != nil {
+			return fmt.Errorf("creating schema_migrations: %w", err)
+		}
+		current, err := migrationVersion(conn)
+		if err != nil {
+			return err
+		}
+		for version := current + 1; version <= len(migrations); version++ {
+			tx, err := conn.BeginTxx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(migrations[version-1]); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("applying migration %d: %w", version, err)
+			}
+			if _, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("recording migration %d: %w", version, err)
+			}
+			if err = tx.Commit(); err != nil {
+				return fmt.Errorf("applying migration %d: %w", version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrationVersion returns the applied schema version and the version this
+// build expects.
+func (d *Database) MigrationVersion() (int, int, error) {
+	version, err := migrationVersion(d.db)
+	return version, len(migrations), err
+}
+
+func migrationVersion(q sqlx.QueryerContext) (int, error) {
+	var version sql.NullInt64
+	err := sqlx.GetContext(context.Background(), q, &version, "SELECT max(version) FROM schema_migrations")
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
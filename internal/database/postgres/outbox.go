@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+// ClaimMail skips the messages claimed by concurrent transactions, and holds
+// the claimed ones by moving their next attempt past the lease.
+func (d *Database) ClaimMail(limit int, lease time.Duration) ([]database.Mail, error) {
+	var mail []database.Mail
+	err := d.db.Select(&mail, `
+		UPDATE outbox SET next_attempt_at = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox WHERE next_attempt_at <= now()
+			ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, recipient, subject, body, attempts`, limit, lease.Seconds())
+	return mail, err
+}
+
+// MarkMailSent clears the body of the message, as it may hold a token.
+func (d *Database) MarkMailSent(id int64) error {
+	_, err := d.db.Exec("UPDATE outbox SET sent_at = now(), next_attempt_at = NULL, body = '' WHERE id = $1", id)
+	return err
+}
+
+func (d *Database) MarkMailFailed(id int64, reason string, retryAt *time.Time) error {
+	_, err := d.db.Exec("UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1", id, reason, retryAt)
+	return err
+}
+
+func (d *Database) PruneMail(before time.Time) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM outbox WHERE next_attempt_at IS NULL AND created_at <= $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -1,31 +1,98 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Paincake/filmbase/internal/database"
-	_ "github.com/jackc/pgx/v5"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
-	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
 )
 
 type Database struct {
-	db *sqlx.DB
+	db         *sqlx.DB
+	connConfig *pgx.ConnConfig
+
+	mu       sync.RWMutex
+	password func() string
 }
 
-func New(dbname, username, password, host, port string) (*Database, error) {
-	connectionString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?&sslmode=disable",
+func connectionString(dbname, username, password, host, port string) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?&sslmode=disable",
 		username,
 		password,
 		host,
 		port,
 		dbname)
-	db, err := sqlx.Connect("pgx", connectionString)
+}
+
+func New(dbname, username, password, host, port string) (*Database, error) {
+	connConfig, err := pgx.ParseConfig(connectionString(dbname, username, password, host, port))
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
-	return &Database{db: db}, nil
+	d := &Database{connConfig: connConfig}
+	d.db = sqlx.NewDb(stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(_ context.Context, cc *pgx.ConnConfig) error {
+		cc.Password = d.currentPassword()
+		return nil
+	})), "pgx")
+	if err = d.db.Ping(); err != nil {
+		d.db.Close()
+		return nil, fmt.Errorf("%w", err)
+	}
+	return d, nil
+}
+
+// SetPasswordFunc makes new connections authenticate with the password returned
+// by password, so that a rotated password is used without reopening the pool.
+func (d *Database) SetPasswordFunc(password func() string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.password = password
+}
+
+func (d *Database) currentPassword() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.password == nil {
+		return d.connConfig.Password
+	}
+	return d.password()
+}
+
+// notify announces a change of entity to every instance listening on
+// database.ChangesChannel. A lost notification only delays eviction until the
+// cache entry expires, so the error is not reported to the caller.
+func (d *Database) notify(entity string) {
+	_, _ = d.db.Exec("SELECT pg_notify($1, $2)", database.ChangesChannel, entity)
+}
+
+// DB returns the underlying connection pool.
+func (d *Database) DB() *sql.DB {
+	return d.db.DB
+}
+
+// ConfigurePool sets the connection pool limits.
+func (d *Database) ConfigurePool(maxOpen, maxIdle int, maxLifetime, maxIdleTime time.Duration) {
+	d.db.SetMaxOpenConns(maxOpen)
+	d.db.SetMaxIdleConns(maxIdle)
+	d.db.SetConnMaxLifetime(maxLifetime)
+	d.db.SetConnMaxIdleTime(maxIdleTime)
+}
+
+// Close closes the connection pool, waiting for running queries to finish.
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+func (d *Database) Ping() error {
+	return d.db.Ping()
 }
+
 func (d *Database) RunMigrations(query ...string) {
 	for _, q := range query {
 		d.db.Query(q)
@@ -35,22 +102,25 @@ func (d *Database) PostActor(actor database.Actor) (int64, error) {
 	var id int64
 	err := d.db.Get(&id, "INSERT INTO actor (name, gender, birthdate) VALUES ($1, $2, $3::date) RETURNING id;", actor.Name, actor.Gender, actor.Birthdate)
 	if err != nil {
-		return 0, err
+		return 0, translate(err, database.EntityActor)
 	}
+	d.notify(database.EntityActor)
 	return id, nil
 }
 func (d *Database) PutActor(actor database.Actor) error {
-	_, err := d.db.Query("UPDATE actor SET name=$1, gender=$2, birthdate=$3;", actor.Name, actor.Gender, actor.Birthdate)
+	_, err := d.db.Exec("UPDATE actor SET name=$1, gender=$2, birthdate=$3;", actor.Name, actor.Gender, actor.Birthdate)
 	if err != nil {
-		return err
+		return translate(err, database.EntityActor)
 	}
+	d.notify(database.EntityActor)
 	return nil
 }
 func (d *Database) DeleteActorById(actorId int64) error {
-	_, err := d.db.Query("DELETE FROM actor WHERE id = $1", actorId)
+	_, err := d.db.Exec("DELETE FROM actor WHERE id = $1", actorId)
 	if err != nil {
-		return err
+		return translateDelete(err, database.EntityActor)
 	}
+	d.notify(database.EntityActor)
 	return nil
 }
 
@@ -68,10 +138,11 @@ func (d *Database) GetActorFilms() ([]database.ActorFilm, error) {
 	return actors, nil
 }
 func (d *Database) PostActorFilm(actorId, filmId int64) error {
-	_, err := d.db.Query("INSERT INTO actor_films (actor_id, film_id) VALUES ($1, $2)", actorId, filmId)
+	_, err := d.db.Exec("INSERT INTO actor_films (actorid, filmid) VALUES ($1, $2)", actorId, filmId)
 	if err != nil {
-		return err
+		return translate(err, "actor film")
 	}
+	d.notify(database.EntityActorFilm)
 	return nil
 }
 func (d *Database) GetFilmSearch(filmName string, actorName string, sortBy string, sortKey string) ([]database.ActorFilm, error) {
@@ -101,40 +172,55 @@ func (d *Database) PostFilm(film database.Film) (int64, error) {
 	var id int64
 	err := d.db.Get(&id, "INSERT INTO film (name, description, release_date, rating) VALUES ($1, $2, $3, $4) RETURNING id", film.Name, film.Description, film.ReleaseDate, film.Rating)
 	if err != nil {
-		return 0, err
+		return 0, translate(err, database.EntityFilm)
 	}
+	d.notify(database.EntityFilm)
 	return id, nil
 }
 func (d *Database) PutFilm(film database.Film) error {
-	_, err := d.db.Query("UPDATE film SET name=$1, description=$2, release_date=$3, rating=$4", film.Name, film.Description, film.ReleaseDate, film.Rating)
+	_, err := d.db.Exec("UPDATE film SET name=$1, description=$2, release_date=$3, rating=$4", film.Name, film.Description, film.ReleaseDate, film.Rating)
 	if err != nil {
-		return err
+		return translate(err, database.EntityFilm)
 	}
+	d.notify(database.EntityFilm)
 	return nil
 }
 func (d *Database) DeleteFilmById(filmId int64) error {
-	_, err := d.db.Query("DELETE FROM film WHERE id = $1", filmId)
+	_, err := d.db.Exec("DELETE FROM film WHERE id = $1", filmId)
 	if err != nil {
-		return err
+		return translateDelete(err, database.EntityFilm)
 	}
-	return err
+	d.notify(database.EntityFilm)
+	return nil
 }
-func (d *Database) Login(username string, password string) (string, error) {
+func (d *Database) UserCredentials(username string) (database.User, error) {
 	var user database.User
-	err := d.db.Get(&user, "SELECT username, password, role FROM api_users WHERE username = $1", username)
+	err := d.db.Get(&user, "SELECT username, password, COALESCE(role, '') AS role, provider FROM api_users WHERE username = $1 AND password IS NOT NULL AND NOT disabled", username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, database.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (d *Database) SetUserPassword(username string, hash string) error {
+	result, err := d.db.Exec("UPDATE api_users SET password = $2 WHERE username = $1", username, hash)
 	if err != nil {
-		return "", err
+		return err
 	}
-	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", err
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return database.ErrUserNotFound
 	}
-	return user.Role, nil
+	return nil
 }
 
-func (d *Database) Signup(username string, password string) error {
-	_, err := d.db.Query("INSERT INTO api_users (username, password) VALUES ($1, $2)", username, password)
+func (d *Database) Signup(username string, password string, role string, email string) error {
+	_, err := d.db.Exec("INSERT INTO api_users (username, password, role, email) VALUES ($1, $2, $3, NULLIF($4, ''))", username, password, role, email)
 	if err != nil {
-		return err
+		return translate(err, "user")
 	}
 	return nil
 }
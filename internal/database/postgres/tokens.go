@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+func (d *Database) CreateRefreshToken(token database.RefreshToken) error {
+	_, err := d.db.Exec("INSERT INTO refresh_tokens (token_hash, family, username, expires_at) VALUES ($1, $2, $3, $4)",
+		token.Hash, token.Family, token.Username, token.ExpiresAt)
+	return err
+}
+
+// RotateRefreshToken spends the token stored under hash in a transaction, so
+// that of two concurrent refreshes with the same token only one succeeds. A
+// token that was already spent or revoked revokes its whole family.
+func (d *Database) RotateRefreshToken(hash string, next database.RefreshToken) (database.User, error) {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		database.RefreshToken
+		Spent bool `db:"spent"`
+	}
+	err = tx.Get(&current, `
+		SELECT token_hash, family, username, expires_at, used_at IS NOT NULL OR revoked_at IS NOT NULL AS spent
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, database.ErrTokenNotFound
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	if current.Spent {
+		if _, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = now() WHERE family = $1 AND revoked_at IS NULL", current.Family); err != nil {
+			return database.User{}, err
+		}
+		if err = tx.Commit(); err != nil {
+			return database.User{}, err
+		}
+		return database.User{}, database.ErrTokenReused
+	}
+	if current.ExpiresAt.Before(time.Now()) {
+		return database.User{}, database.ErrTokenExpired
+	}
+	// The tokens of disabled users are revoked, this covers a refresh racing
+	// the revocation.
+	user := database.User{Username: current.Username}
+	err = tx.Get(&user.Role, "SELECT COALESCE(role, '') FROM api_users WHERE username = $1 AND NOT disabled", current.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, database.ErrUserNotFound
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if _, err = tx.Exec("UPDATE refresh_tokens SET used_at = now() WHERE token_hash = $1", hash); err != nil {
+		return database.User{}, err
+	}
+	if _, err = tx.Exec("INSERT INTO refresh_tokens (token_hash, family, username, expires_at) VALUES ($1, $2, $3, $4)",
+		next.Hash, current.Family, current.Username, next.ExpiresAt); err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (d *Database) RevokeRefreshToken(hash string, username string) error {
+	_, err := d.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = now()
+		WHERE revoked_at IS NULL AND family = (SELECT family FROM refresh_tokens WHERE token_hash = $1 AND username = $2)`,
+		hash, username)
+	return err
+}
+
+func (d *Database) RevokeToken(jti string, expiresAt time.Time) error {
+	_, err := d.db.Exec("INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", jti, expiresAt)
+	if err != nil {
+		return err
+	}
+	d.notify(database.EntityRevocation)
+	return nil
+}
+
+// RevokeUserTokens revokes the access tokens of username by the time they were
+// issued, so that tokens issued afterwards are accepted. The time is truncated
+// to the second of the iat claim, else tokens issued later within the same
+// second, as on a login right after a password reset, would be rejected.
+func (d *Database) RevokeUserTokens(username string) error {
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`
+		INSERT INTO user_revocations (username, revoked_before) SELECT username, date_trunc('second', now()) FROM api_users WHERE username = $1
+		ON CONFLICT (username) DO UPDATE SET revoked_before = excluded.revoked_before`, username)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return database.ErrUserNotFound
+	}
+	if _, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = now() WHERE username = $1 AND revoked_at IS NULL", username); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	d.notify(database.EntityRevocation)
+	return nil
+}
+
+func (d *Database) IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := d.db.Get(&revoked, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM user_revocations WHERE username = $2 AND revoked_before > $3)
+			OR NOT EXISTS (SELECT 1 FROM api_users WHERE username = $2 AND NOT disabled)`,
+		jti, username, issuedAt)
+	return revoked, err
+}
+
+// PruneTokens deletes revocations of access tokens that expired anyway and
+// refresh and mailed tokens that can no longer be used. Spent refresh tokens
+// are kept until they expire so that their reuse is still detected.
+func (d *Database) PruneTokens() (int64, error) {
+	var pruned int64
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at < now()",
+		"DELETE FROM refresh_tokens WHERE expires_at < now()",
+		"DELETE FROM user_tokens WHERE expires_at < now()",
+	} {
+		result, err := d.db.Exec(query)
+		if err != nil {
+			return pruned, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return pruned, err
+		}
+		pruned += n
+	}
+	return pruned, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+)
+
+func (d *Database) ListUsers() ([]database.User, error) {
+	var users []database.User
+	err := d.db.Select(&users, `
+		SELECT username, COALESCE(role, '') AS role, disabled, provider, COALESCE(email, '') AS email, email_verified
+		FROM api_users ORDER BY username`)
+	return users, err
+}
+
+func (d *Database) SetUserRole(username string, role string) error {
+	result, err := d.db.Exec("UPDATE api_users SET role = $2 WHERE username = $1 AND provider = $3", username, role, database.LocalProvider)
+	if err != nil {
+		return err
+	}
+	err = d.userChanged(result)
+	if !errors.Is(err, database.ErrUserNotFound) {
+		return err
+	}
+	var exists bool
+	if err = d.db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM api_users WHERE username = $1)", username); err != nil {
+		return err
+	}
+	if exists {
+		return database.ErrUserProvisioned
+	}
+	return database.ErrUserNotFound
+}
+
+func (d *Database) SetUserDisabled(username string, disabled bool) error {
+	result, err := d.db.Exec("UPDATE api_users SET disabled = $2 WHERE username = $1", username, disabled)
+	if err != nil {
+		return err
+	}
+	return d.userChanged(result)
+}
+
+func (d *Database) DeleteUser(username string) error {
+	result, err := d.db.Exec("DELETE FROM api_users WHERE username = $1", username)
+	if err != nil {
+		return err
+	}
+	return d.userChanged(result)
+}
+
+// ProvisionUser keeps the users of external providers in api_users, without a
+// password, so that they can be managed like local users. A user of another
+// provider with the same name is never taken over.
+func (d *Database) ProvisionUser(username string, provider string, role string) (database.User, error) {
+	var user database.User
+	err := d.db.Get(&user, `
+		INSERT INTO api_users (username, role, provider) VALUES ($1, $2, $3)
+		ON CONFLICT (username) DO UPDATE SET role = excluded.role WHERE api_users.provider = excluded.provider
+		RETURNING username, COALESCE(role, '') AS role, disabled, provider`, username, role, provider)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, database.ErrUserConflict
+	}
+	return user, err
+}
+
+// userChanged reports a change of a user that does not exist and otherwise
+// announces it, as the tokens of a disabled or deleted user are revoked.
+func (d *Database) userChanged(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return database.ErrUserNotFound
+	}
+	d.notify(database.EntityRevocation)
+	return nil
+}
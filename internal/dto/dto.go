@@ -1,18 +1,20 @@
 package dto
 
+import "time"
+
 type Actor struct {
 	Id        int64  `json:"id" required:"true"`
-	Name      string `json:"name" required:"true" validate:"nonzero"`
-	Gender    string `json:"gender" required:"true" validate:"nonzero"`
-	Birthdate string `json:"birthdate" required:"true" validate:"nonzero"`
+	Name      string `json:"name" required:"true" validate:"min=2,max=50"`
+	Gender    string `json:"gender" required:"true" validate:"oneof=male|female"`
+	Birthdate Date   `json:"birthdate" required:"true" validate:"date,past"`
 }
 
 type Film struct {
 	Id          int64  `json:"id" required:"true"`
-	Name        string `json:"name" required:"true" validate:"nonzero, min=1,max=50"`
-	Description string `json:"description" required:"true" validate:"nonzero, min=1,max=1000"`
-	ReleaseDate string `json:"release-date" required:"true" validate:"nonzero"`
-	Rating      int    `json:"rating" required:"true" validate:"nonzero"`
+	Name        string `json:"name" required:"true" validate:"min=2,max=50"`
+	Description string `json:"description" required:"true" validate:"nonzero,max=1000"`
+	ReleaseDate Date   `json:"release-date" required:"true" validate:"date"`
+	Rating      int    `json:"rating" required:"true" validate:"min=0,max=10"`
 }
 
 type ActorFilm struct {
@@ -21,6 +23,153 @@ type ActorFilm struct {
 }
 
 type User struct {
-	Username string `json:"username" required:"true" validate:"nonzero"`
+	Username string `json:"username" required:"true" validate:"nonzero,username"`
+	Password string `json:"password" required:"true" validate:"nonzero"`
+	// Email is where password reset mail is sent, it is verified on signup.
+	Email string `json:"email,omitempty"`
+}
+
+// UserInfo is a user as listed to admins.
+type UserInfo struct {
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	Disabled      bool   `json:"disabled"`
+	Provider      string `json:"provider"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+type Role struct {
+	Role string `json:"role" required:"true" validate:"nonzero"`
+}
+
+// APIKeyRequest creates an API key. Without scopes the key is granted every
+// scope of its role.
+type APIKeyRequest struct {
+	Name      string     `json:"name" required:"true" validate:"nonzero,max=100"`
+	Role      string     `json:"role" required:"true" validate:"nonzero"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyInfo is an API key as listed to admins.
+type APIKeyInfo struct {
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKey is a new API key. The key is only ever shown once.
+type CreatedAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// Token is issued on login and on refresh.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// MFAChallenge is returned by a login that is completed with a one-time
+// password, or with a TOTP secret enrolled first when EnrollmentRequired.
+type MFAChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	// ExpiresIn is the lifetime of the challenge token in seconds.
+	ExpiresIn          int  `json:"expires_in"`
+	EnrollmentRequired bool `json:"enrollment_required"`
+}
+
+// MFALogin completes a login with a one-time password or a recovery code.
+type MFALogin struct {
+	ChallengeToken string `json:"challenge_token" required:"true" validate:"nonzero"`
+	Code           string `json:"code" required:"true" validate:"nonzero"`
+}
+
+// MFAEnrollment enrolls a TOTP secret during a login that requires one.
+type MFAEnrollment struct {
+	ChallengeToken string `json:"challenge_token" required:"true" validate:"nonzero"`
+}
+
+// MFAToken is issued on a login completed with a one-time password. Recovery
+// codes are only returned when the login confirmed a new TOTP secret.
+type MFAToken struct {
+	Token
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TOTPEnrollment is a new TOTP secret and the otpauth URI to provision an
+// authenticator app with, usually as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// OTP is a one-time password, or a recovery code where one is accepted.
+type OTP struct {
+	Code string `json:"code" required:"true" validate:"nonzero"`
+}
+
+// RecoveryCodes are only ever shown once.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" required:"true" validate:"nonzero"`
+}
+
+// EmailRequest asks for mail to be sent to the user with Email.
+type EmailRequest struct {
+	Email string `json:"email" required:"true" validate:"nonzero"`
+}
+
+// PasswordReset sets a new password with a mailed reset token.
+type PasswordReset struct {
+	Token    string `json:"token" required:"true" validate:"nonzero"`
 	Password string `json:"password" required:"true" validate:"nonzero"`
 }
+
+// EmailVerification verifies an email with a mailed token.
+type EmailVerification struct {
+	Token string `json:"token" required:"true" validate:"nonzero"`
+}
+
+type Check struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Version  int    `json:"version,omitempty"`
+	Expected int    `json:"expected,omitempty"`
+}
+
+type Health struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and the exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and the public key of OKP keys, X and Y the
+	// coordinates of EC keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
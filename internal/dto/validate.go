@@ -0,0 +1,180 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"gopkg.in/validator.v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of dates, as format: date of the API spec.
+const DateLayout = time.DateOnly
+
+// Date is a calendar date, a YYYY-MM-DD string in JSON.
+type Date struct {
+	time.Time
+	// invalid is the text of a date that does not parse. It is reported by
+	// Validate along with the other invalid fields rather than by decoding.
+	invalid string
+}
+
+// NewDate returns the date of t.
+func NewDate(t time.Time) Date {
+	return Date{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+func (d Date) String() string {
+	if d.invalid != "" {
+		return d.invalid
+	}
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(DateLayout))
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*d = Date{}
+	if text == "" {
+		return nil
+	}
+	t, err := time.Parse(DateLayout, text)
+	if err != nil {
+		d.invalid = text
+		return nil
+	}
+	d.Time = t
+	return nil
+}
+
+// validate checks the validate tags of requests, naming fields as in JSON.
+var validate = validator.NewValidator().WithPrintJSON(true)
+
+// now is the time dates are checked against.
+var now = time.Now
+
+func init() {
+	validate.SetValidationFunc("nonzero", nonzero)
+	validate.SetValidationFunc("min", atLeast)
+	validate.SetValidationFunc("max", atMost)
+	validate.SetValidationFunc("oneof", oneOf)
+	validate.SetValidationFunc("date", date)
+	validate.SetValidationFunc("past", past)
+	validate.SetValidationFunc("username", username)
+}
+
+// Validate checks v by its validate tags and returns a validation error
+// listing every invalid field, nil when v is valid. Every entry point that
+// accepts actors, films or users checks them with Validate.
+func Validate(v any) error {
+	err := validate.Validate(v)
+	var invalid validator.ErrorMap
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	var fields []database.FieldError
+	for field, errs := range invalid {
+		for _, err := range errs {
+			fields = append(fields, database.FieldError{Field: field, Message: err.Error()})
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return database.Invalid(fields...)
+}
+
+// nonzero, atLeast and atMost are the builtins of validator, with messages
+// that tell clients what is expected.
+
+func nonzero(v any, _ string) error {
+	if validator.Valid(v, "nonzero") != nil {
+		return errors.New("is required")
+	}
+	return nil
+}
+
+func atLeast(v any, param string) error {
+	if validator.Valid(v, "min="+param) == nil {
+		return nil
+	}
+	if _, ok := v.(string); ok {
+		return fmt.Errorf("must be at least %s characters long", param)
+	}
+	return fmt.Errorf("must be at least %s", param)
+}
+
+func atMost(v any, param string) error {
+	if validator.Valid(v, "max="+param) == nil {
+		return nil
+	}
+	if _, ok := v.(string); ok {
+		return fmt.Errorf("must be at most %s characters long", param)
+	}
+	return fmt.Errorf("must be at most %s", param)
+}
+
+// oneOf validates that v is one of the values of param, separated by |.
+func oneOf(v any, param string) error {
+	values := strings.Split(param, "|")
+	for _, value := range values {
+		if fmt.Sprint(v) == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+}
+
+// date validates that v is a date that was given and parsed.
+func date(v any, _ string) error {
+	d, ok := v.(Date)
+	switch {
+	case !ok:
+		return validator.ErrUnsupported
+	case d.invalid != "":
+		return errors.New("must be a date of the form YYYY-MM-DD")
+	case d.IsZero():
+		return errors.New("is required")
+	}
+	return nil
+}
+
+// past validates that v is not a date after today.
+func past(v any, _ string) error {
+	d, ok := v.(Date)
+	if !ok {
+		return validator.ErrUnsupported
+	}
+	if d.After(NewDate(now()).Time) {
+		return errors.New("must not be in the future")
+	}
+	return nil
+}
+
+// username validates that v is a username that can log in with Basic
+// authentication, which splits the username from the password at the first
+// colon. API keys authenticate under names with a colon, which no user can
+// take then.
+func username(v any, _ string) error {
+	s, ok := v.(string)
+	if !ok {
+		return validator.ErrUnsupported
+	}
+	if strings.Contains(s, ":") {
+		return errors.New("must not contain a colon")
+	}
+	return nil
+}
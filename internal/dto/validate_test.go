@@ -0,0 +1,69 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestValidate_ShouldReportEveryInvalidField(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	var actor Actor
+	if err := json.Unmarshal([]byte(`{"name":"J","gender":"other","birthdate":"2024-06-02"}`), &actor); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	err := Validate(actor)
+	var invalid *database.Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("test failed: %v is not a domain error", err)
+	}
+	assert.ErrorIs(t, err, database.ErrValidation)
+	assert.Equal(t, []database.FieldError{
+		{Field: "birthdate", Message: "must not be in the future"},
+		{Field: "gender", Message: "must be one of male, female"},
+		{Field: "name", Message: "must be at least 2 characters long"},
+	}, invalid.Fields)
+
+	actor.Birthdate = NewDate(now())
+	actor.Gender = "female"
+	actor.Name = "Jane"
+	assert.NoError(t, Validate(actor))
+}
+
+func TestValidate_ShouldCheckDatesAndEnums(t *testing.T) {
+	var film Film
+	if err := json.Unmarshal([]byte(`{"name":"Bladerunner 2049","release-date":"05/10/2017","rating":11}`), &film); err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	var invalid *database.Error
+	if !errors.As(Validate(film), &invalid) {
+		t.Fatalf("test failed: %+v is valid", film)
+	}
+	assert.Equal(t, []database.FieldError{
+		{Field: "description", Message: "is required"},
+		{Field: "rating", Message: "must be at most 10"},
+		{Field: "release-date", Message: "must be a date of the form YYYY-MM-DD"},
+	}, invalid.Fields)
+
+	film = Film{Name: "Bladerunner 2049", Description: "Villeneuve", Rating: 0}
+	assert.Error(t, Validate(film))
+	film.ReleaseDate = NewDate(time.Date(2017, 10, 5, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, Validate(film))
+	body, _ := json.Marshal(film)
+	assert.Contains(t, string(body), `"release-date":"2017-10-05"`)
+}
+
+func TestValidate_ShouldRejectColonInUsername(t *testing.T) {
+	err := Validate(User{Username: "apikey:abc", Password: "password"})
+	var invalid *database.Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("test failed: %v is not a domain error", err)
+	}
+	assert.Equal(t, []database.FieldError{{Field: "username", Message: "must not contain a colon"}}, invalid.Fields)
+	assert.NoError(t, Validate(User{Username: "alice", Password: "password"}))
+}
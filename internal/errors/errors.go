@@ -1,6 +1,9 @@
 package errors
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+)
 
 type UnescapedCookieParamError struct {
 	ParamName string
@@ -70,3 +73,25 @@ type TooManyValuesForParamError struct {
 func (e *TooManyValuesForParamError) Error() string {
 	return fmt.Sprintf("Expected one value for %s, got %d", e.ParamName, e.Count)
 }
+
+// FieldErrors of parameter errors name the parameter at fault.
+
+func (e *UnmarshalingParamError) FieldErrors() []database.FieldError {
+	return []database.FieldError{{Field: e.ParamName, Message: "is not valid JSON"}}
+}
+
+func (e *RequiredParamError) FieldErrors() []database.FieldError {
+	return []database.FieldError{{Field: e.ParamName, Message: "is required"}}
+}
+
+func (e *RequiredHeaderError) FieldErrors() []database.FieldError {
+	return []database.FieldError{{Field: e.ParamName, Message: "is required"}}
+}
+
+func (e *InvalidParamFormatError) FieldErrors() []database.FieldError {
+	return []database.FieldError{{Field: e.ParamName, Message: e.Err.Error()}}
+}
+
+func (e *TooManyValuesForParamError) FieldErrors() []database.FieldError {
+	return []database.FieldError{{Field: e.ParamName, Message: fmt.Sprintf("expects one value, got %d", e.Count)}}
+}
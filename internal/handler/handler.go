@@ -5,7 +5,9 @@ import (
 	"github.com/Paincake/filmbase/internal/database"
 	"github.com/Paincake/filmbase/internal/errors"
 	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/Paincake/filmbase/internal/policy"
 	"github.com/Paincake/filmbase/internal/server"
+	"github.com/Paincake/filmbase/internal/tracing"
 	"github.com/oapi-codegen/runtime"
 	"log/slog"
 	"net/http"
@@ -19,13 +21,25 @@ type ServerInterfaceWrapper struct {
 	ErrorHandlerFunc   func(w http.ResponseWriter, r *http.Request, err error)
 }
 
+// repository returns the repository tracing its calls under the request span.
+func (siw *ServerInterfaceWrapper) repository(r *http.Request) database.FilmbaseRepository {
+	return tracing.NewRepository(r.Context(), siw.Repository)
+}
+
+// logger returns the logger of the request, annotated with its trace by
+// tracing.StartServerSpan.
+func (siw *ServerInterfaceWrapper) logger(r *http.Request) *slog.Logger {
+	return middleware.Logger(r.Context(), tracing.Logger(r.Context(), siw.Logger))
+}
+
 // CreateActor operation middleware
 func (siw *ServerInterfaceWrapper) CreateActor(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "CreateActor")
+	defer span.End()
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.CreateActor(w, r, siw.Repository, siw.Logger)
+		siw.Handler.CreateActor(w, r, siw.repository(r), siw.logger(r))
 	}))
 	for _, middleware := range siw.HandlerMiddlewares {
 		handler = middleware(handler)
@@ -36,12 +50,13 @@ func (siw *ServerInterfaceWrapper) CreateActor(w http.ResponseWriter, r *http.Re
 
 // PutActor operation middleware
 func (siw *ServerInterfaceWrapper) PutActor(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "PutActor")
+	defer span.End()
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PutActor(w, r, siw.Repository, siw.Logger)
+		siw.Handler.PutActor(w, r, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -53,12 +68,13 @@ func (siw *ServerInterfaceWrapper) PutActor(w http.ResponseWriter, r *http.Reque
 
 // GetActorFilms operation middleware
 func (siw *ServerInterfaceWrapper) GetActorFilms(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "GetActorFilms")
+	defer span.End()
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetActorFilms(w, r, siw.Repository, siw.Logger)
+		siw.Handler.GetActorFilms(w, r, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -70,7 +86,8 @@ func (siw *ServerInterfaceWrapper) GetActorFilms(w http.ResponseWriter, r *http.
 
 // DeleteActor operation middleware
 func (siw *ServerInterfaceWrapper) DeleteActor(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "DeleteActor")
+	defer span.End()
 
 	var err error
 
@@ -83,10 +100,10 @@ func (siw *ServerInterfaceWrapper) DeleteActor(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.DeleteActor(w, r, actorId, siw.Repository, siw.Logger)
+		siw.Handler.DeleteActor(w, r, actorId, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -98,7 +115,8 @@ func (siw *ServerInterfaceWrapper) DeleteActor(w http.ResponseWriter, r *http.Re
 
 // PostActorFilm operation middleware
 func (siw *ServerInterfaceWrapper) PostActorFilm(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "PostActorFilm")
+	defer span.End()
 
 	var err error
 
@@ -120,10 +138,10 @@ func (siw *ServerInterfaceWrapper) PostActorFilm(w http.ResponseWriter, r *http.
 		return
 	}
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.PostActorFilm(w, r, actorId, filmId, siw.Repository, siw.Logger)
+		siw.Handler.PostActorFilm(w, r, actorId, filmId, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -135,11 +153,12 @@ func (siw *ServerInterfaceWrapper) PostActorFilm(w http.ResponseWriter, r *http.
 
 // GetFilm operation middleware
 func (siw *ServerInterfaceWrapper) GetFilm(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "GetFilm")
+	defer span.End()
 
 	var err error
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"read"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
 
 	// Parameter object where we will unmarshal all parameters from the context
 	var params server.GetFilmParams
@@ -161,7 +180,7 @@ func (siw *ServerInterfaceWrapper) GetFilm(w http.ResponseWriter, r *http.Reques
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetFilm(w, r, params, siw.Repository, siw.Logger)
+		siw.Handler.GetFilm(w, r, params, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -173,12 +192,13 @@ func (siw *ServerInterfaceWrapper) GetFilm(w http.ResponseWriter, r *http.Reques
 
 // CreateFilm operation middleware
 func (siw *ServerInterfaceWrapper) CreateFilm(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "CreateFilm")
+	defer span.End()
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.CreateFilm(w, r, siw.Repository, siw.Logger)
+		siw.Handler.CreateFilm(w, r, siw.repository(r), siw.logger(r))
 	}))
 	for _, middleware := range siw.HandlerMiddlewares {
 		handler = middleware(handler)
@@ -189,12 +209,13 @@ func (siw *ServerInterfaceWrapper) CreateFilm(w http.ResponseWriter, r *http.Req
 
 // ChangeFilm operation middleware
 func (siw *ServerInterfaceWrapper) ChangeFilm(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "ChangeFilm")
+	defer span.End()
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.ChangeFilm(w, r, siw.Repository, siw.Logger)
+		siw.Handler.ChangeFilm(w, r, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -206,11 +227,12 @@ func (siw *ServerInterfaceWrapper) ChangeFilm(w http.ResponseWriter, r *http.Req
 
 // GetFilmSearch operation middleware
 func (siw *ServerInterfaceWrapper) GetFilmSearch(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "GetFilmSearch")
+	defer span.End()
 
 	var err error
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"read"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
 
 	// Parameter object where we will unmarshal all parameters from the context
 	var params server.GetFilmSearchParams
@@ -262,7 +284,7 @@ func (siw *ServerInterfaceWrapper) GetFilmSearch(w http.ResponseWriter, r *http.
 	}
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.GetFilmSearch(w, r, params, siw.Repository, siw.Logger)
+		siw.Handler.GetFilmSearch(w, r, params, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -273,7 +295,8 @@ func (siw *ServerInterfaceWrapper) GetFilmSearch(w http.ResponseWriter, r *http.
 
 // DeleteFilm operation middleware
 func (siw *ServerInterfaceWrapper) DeleteFilm(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "DeleteFilm")
+	defer span.End()
 
 	var err error
 
@@ -286,10 +309,10 @@ func (siw *ServerInterfaceWrapper) DeleteFilm(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeWrite})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.DeleteFilm(w, r, filmId, siw.Repository, siw.Logger)
+		siw.Handler.DeleteFilm(w, r, filmId, siw.repository(r), siw.logger(r))
 	}))
 
 	for _, middleware := range siw.HandlerMiddlewares {
@@ -299,24 +322,437 @@ func (siw *ServerInterfaceWrapper) DeleteFilm(w http.ResponseWriter, r *http.Req
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 func (siw *ServerInterfaceWrapper) Login(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx, span := tracing.StartServerSpan(r, "Login")
+	defer span.End()
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.Login(w, r, siw.Repository, siw.Logger)
+		siw.Handler.Login(w, r, siw.repository(r), siw.logger(r))
 	}))
 
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
 func (siw *ServerInterfaceWrapper) Signup(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx, span := tracing.StartServerSpan(r, "Signup")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.Signup(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// LoginMFA and EnrollLoginTOTP operation middlewares. The MFA challenge issued
+// by Login is the credential, so the requests are not authenticated.
+func (siw *ServerInterfaceWrapper) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "LoginMFA")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.LoginMFA(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+func (siw *ServerInterfaceWrapper) EnrollLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "EnrollLoginTOTP")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.EnrollLoginTOTP(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ForgotPassword, ResetPassword, RequestEmailVerification and VerifyEmail
+// operation middlewares. Mailed tokens are the credentials, so the requests
+// are not authenticated.
+func (siw *ServerInterfaceWrapper) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "ForgotPassword")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ForgotPassword(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+func (siw *ServerInterfaceWrapper) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "ResetPassword")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ResetPassword(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+func (siw *ServerInterfaceWrapper) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "RequestEmailVerification")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RequestEmailVerification(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+func (siw *ServerInterfaceWrapper) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "VerifyEmail")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.VerifyEmail(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RefreshToken operation middleware. The refresh token is the credential, so
+// the request is not authenticated.
+func (siw *ServerInterfaceWrapper) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "RefreshToken")
+	defer span.End()
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RefreshToken(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Logout operation middleware
+func (siw *ServerInterfaceWrapper) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "Logout")
+	defer span.End()
+
+	// Any authenticated user may log out.
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.Logout(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RevokeUserTokens operation middleware
+func (siw *ServerInterfaceWrapper) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "RevokeUserTokens")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RevokeUserTokens(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ListUsers operation middleware
+func (siw *ServerInterfaceWrapper) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "ListUsers")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ListUsers(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// SetUserRole operation middleware
+func (siw *ServerInterfaceWrapper) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "SetUserRole")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.SetUserRole(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DisableUser operation middleware
+func (siw *ServerInterfaceWrapper) DisableUser(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "DisableUser")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DisableUser(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// EnableUser operation middleware
+func (siw *ServerInterfaceWrapper) EnableUser(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "EnableUser")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.EnableUser(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// UnlockUser operation middleware
+func (siw *ServerInterfaceWrapper) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "UnlockUser")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.UnlockUser(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DeleteUser operation middleware
+func (siw *ServerInterfaceWrapper) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "DeleteUser")
+	defer span.End()
+
+	// ------------- Path parameter "username" -------------
+	username := r.PathValue("username")
+	if username == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "username"})
+		return
+	}
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteUser(w, r, username, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// BeginTOTP operation middleware
+func (siw *ServerInterfaceWrapper) BeginTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "BeginTOTP")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.BeginTOTP(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ConfirmTOTP operation middleware
+func (siw *ServerInterfaceWrapper) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "ConfirmTOTP")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ConfirmTOTP(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DeleteTOTP operation middleware
+func (siw *ServerInterfaceWrapper) DeleteTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "DeleteTOTP")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteTOTP(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RegenerateRecoveryCodes operation middleware
+func (siw *ServerInterfaceWrapper) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "RegenerateRecoveryCodes")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeRead})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.RegenerateRecoveryCodes(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// CreateAPIKey operation middleware
+func (siw *ServerInterfaceWrapper) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "CreateAPIKey")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.CreateAPIKey(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ListAPIKeys operation middleware
+func (siw *ServerInterfaceWrapper) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "ListAPIKeys")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ListAPIKeys(w, r, siw.repository(r), siw.logger(r))
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// DeleteAPIKey operation middleware
+func (siw *ServerInterfaceWrapper) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartServerSpan(r, "DeleteAPIKey")
+	defer span.End()
+
+	// ------------- Path parameter "prefix" -------------
+	prefix := r.PathValue("prefix")
+	if prefix == "" {
+		siw.ErrorHandlerFunc(w, r, &errors.RequiredParamError{ParamName: "prefix"})
+		return
+	}
 
-	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{"write"})
+	ctx = context.WithValue(ctx, server.Filmbase_authScopes, []string{policy.ScopeAdmin})
 
 	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		siw.Handler.Signup(w, r, siw.Repository, siw.Logger)
+		siw.Handler.DeleteAPIKey(w, r, prefix, siw.repository(r), siw.logger(r))
 	}))
 
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
 	handler.ServeHTTP(w, r.WithContext(ctx))
 }
+
+// JWKS operation middleware. The public keys are not secret.
+func (siw *ServerInterfaceWrapper) JWKS(w http.ResponseWriter, r *http.Request) {
+	siw.Handler.JWKS(w, r, siw.Repository, siw.Logger)
+}
+
+// Healthz operation middleware. Probes are never authenticated.
+func (siw *ServerInterfaceWrapper) Healthz(w http.ResponseWriter, r *http.Request) {
+	siw.Handler.Healthz(w, r, siw.Repository, siw.Logger)
+}
+
+// Readyz operation middleware. Probes are never authenticated.
+func (siw *ServerInterfaceWrapper) Readyz(w http.ResponseWriter, r *http.Request) {
+	siw.Handler.Readyz(w, r, siw.Repository, siw.Logger)
+}
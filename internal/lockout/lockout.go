@@ -0,0 +1,127 @@
+// Package lockout slows down password guessing. Failed logins are counted per
+// username and per client, every failure doubles the delay before the next
+// attempt and too many failures lock the username or the client out.
+package lockout
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+// Store keeps the failed login attempts per key. The repository stores them
+// in the database, so that they are shared by every instance, Memory keeps
+// them in the process.
+type Store interface {
+	RecordLoginAttempt(key string, at time.Time, since time.Time) (database.LoginAttempts, error)
+	ForgiveLoginAttempt(key string) error
+	ResetLoginAttempts(key string) error
+	PruneLoginAttempts(before time.Time) (int64, error)
+}
+
+// Options are the limits of failed logins.
+type Options struct {
+	// MaxUserFailures and MaxClientFailures are the failures after which a
+	// username or a client is locked out. Clients get more, as several users
+	// may share an address.
+	MaxUserFailures   int
+	MaxClientFailures int
+	// LockoutDuration is how long a username or a client is locked out. Failures
+	// are forgotten once no attempt failed for as long.
+	LockoutDuration time.Duration
+	// BaseDelay is the delay after the first failure, doubled on every further
+	// failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Guard decides whether a login may be attempted.
+type Guard struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+func New(store Store, opts Options) *Guard {
+	return &Guard{store: store, opts: opts, now: time.Now}
+}
+
+func userKey(username string) string {
+	return "user:" + username
+}
+
+func clientKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+// Attempt counts a login of username from clientIP as failed before its
+// credentials are checked, so that concurrent guesses cannot all pass the
+// check before any of them is counted. It returns how long to wait before
+// attempting a login, zero when this one may proceed. Throttled attempts are
+// taken back, as their credentials are not checked.
+func (g *Guard) Attempt(username string, clientIP string) (time.Duration, error) {
+	now := g.now()
+	since := now.Add(-g.opts.LockoutDuration)
+	var wait time.Duration
+	for _, k := range []struct {
+		key string
+		max int
+	}{{userKey(username), g.opts.MaxUserFailures}, {clientKey(clientIP), g.opts.MaxClientFailures}} {
+		attempts, err := g.store.RecordLoginAttempt(k.key, now, since)
+		if err != nil {
+			return 0, err
+		}
+		before := database.LoginAttempts{Failures: attempts.Failures - 1, LastFailure: attempts.PreviousFailure}
+		wait = max(wait, g.wait(before, k.max))
+	}
+	if wait > 0 {
+		if err := g.Forgive(username, clientIP); err != nil {
+			return 0, err
+		}
+	}
+	return wait, nil
+}
+
+func (g *Guard) wait(attempts database.LoginAttempts, maxFailures int) time.Duration {
+	if attempts.Failures <= 0 {
+		return 0
+	}
+	delay := g.opts.LockoutDuration
+	if attempts.Failures < maxFailures {
+		delay = g.opts.BaseDelay
+		for i := 1; i < attempts.Failures && delay < g.opts.MaxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, g.opts.MaxDelay)
+	}
+	return max(0, attempts.LastFailure.Add(delay).Sub(g.now()))
+}
+
+// Forgive takes back the attempt of username from clientIP, which was throttled
+// or whose credentials were valid while a second factor is awaited, without
+// forgetting the failures before it.
+func (g *Guard) Forgive(username string, clientIP string) error {
+	if err := g.store.ForgiveLoginAttempt(userKey(username)); err != nil {
+		return err
+	}
+	return g.store.ForgiveLoginAttempt(clientKey(clientIP))
+}
+
+// Succeed forgets the failures of username and takes back the attempt from
+// clientIP. The other failures of the client are kept, so that guessing the
+// passwords of other users is still slowed down.
+func (g *Guard) Succeed(username string, clientIP string) error {
+	if err := g.store.ResetLoginAttempts(userKey(username)); err != nil {
+		return err
+	}
+	return g.store.ForgiveLoginAttempt(clientKey(clientIP))
+}
+
+// Unlock forgets the failures of username, lifting its lockout.
+func (g *Guard) Unlock(username string) error {
+	return g.store.ResetLoginAttempts(userKey(username))
+}
+
+// Prune deletes the failures that are forgotten anyway.
+func (g *Guard) Prune() (int64, error) {
+	return g.store.PruneLoginAttempts(g.now().Add(-g.opts.LockoutDuration))
+}
@@ -0,0 +1,99 @@
+package lockout
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newGuard(now *time.Time) *Guard {
+	g := New(NewMemory(), Options{
+		MaxUserFailures:   3,
+		MaxClientFailures: 5,
+		LockoutDuration:   time.Hour,
+		BaseDelay:         time.Second,
+		MaxDelay:          3 * time.Second,
+	})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func attempt(t *testing.T, g *Guard, username, clientIP string) time.Duration {
+	wait, err := g.Attempt(username, clientIP)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return wait
+}
+
+func TestGuard_ShouldBackOffAndLockOut(t *testing.T) {
+	now := time.Now()
+	g := newGuard(&now)
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.1"))
+	assert.Equal(t, time.Second, attempt(t, g, "alice", "192.0.2.2"))
+	assert.Equal(t, time.Second, attempt(t, g, "bob", "192.0.2.1"))
+	assert.Zero(t, attempt(t, g, "bob", "192.0.2.2"))
+
+	now = now.Add(time.Second)
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.3"))
+	assert.Equal(t, 2*time.Second, attempt(t, g, "alice", "192.0.2.4"))
+	now = now.Add(2 * time.Second)
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.4"))
+	assert.Equal(t, time.Hour, attempt(t, g, "alice", "192.0.2.5"))
+
+	assert.NoError(t, g.Unlock("alice"))
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.5"))
+}
+
+func TestGuard_ShouldCountConcurrentAttempts(t *testing.T) {
+	now := time.Now()
+	g := newGuard(&now)
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if wait, err := g.Attempt("alice", fmt.Sprintf("192.0.2.%d", i)); err == nil && wait == 0 {
+				allowed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), allowed.Load())
+}
+
+func TestGuard_ShouldTakeBackValidAttempts(t *testing.T) {
+	now := time.Now()
+	g := newGuard(&now)
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.1"))
+	assert.NoError(t, g.Succeed("alice", "192.0.2.1"))
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.1"))
+	assert.NoError(t, g.Succeed("alice", "192.0.2.1"))
+
+	assert.Zero(t, attempt(t, g, "bob", "192.0.2.2"))
+	now = now.Add(time.Second)
+	assert.Zero(t, attempt(t, g, "bob", "192.0.2.2"))
+	assert.NoError(t, g.Forgive("bob", "192.0.2.2"))
+	assert.Zero(t, attempt(t, g, "bob", "192.0.2.2"))
+}
+
+func TestGuard_ShouldForgetFailuresAfterLockout(t *testing.T) {
+	now := time.Now()
+	g := newGuard(&now)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, attempt(t, g, "alice", "192.0.2.1"))
+		now = now.Add(2 * time.Second)
+	}
+	assert.Equal(t, time.Hour-2*time.Second, attempt(t, g, "alice", "192.0.2.2"))
+
+	now = now.Add(time.Hour)
+	assert.Zero(t, attempt(t, g, "alice", "192.0.2.2"))
+
+	pruned, err := g.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+}
@@ -0,0 +1,85 @@
+package lockout
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping failed login attempts in the process. Attempts
+// are lost on restart and not shared between instances.
+type Memory struct {
+	mu       sync.Mutex
+	attempts map[string]database.LoginAttempts
+	// pruneAt is the number of keys at which forgotten attempts are pruned.
+	pruneAt int
+}
+
+// minPruneAt is the number of keys below which attempts are never pruned.
+const minPruneAt = 1024
+
+func NewMemory() *Memory {
+	return &Memory{attempts: make(map[string]database.LoginAttempts), pruneAt: minPruneAt}
+}
+
+func (m *Memory) RecordLoginAttempt(key string, at time.Time, since time.Time) (database.LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts := m.attempts[key]
+	if !attempts.LastFailure.After(since) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.PreviousFailure = attempts.LastFailure
+	attempts.LastFailure = at
+	m.attempts[key] = attempts
+	if len(m.attempts) >= m.pruneAt {
+		m.prune(since)
+		m.pruneAt = max(minPruneAt, 2*len(m.attempts))
+	}
+	return attempts, nil
+}
+
+func (m *Memory) ForgiveLoginAttempt(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts, ok := m.attempts[key]
+	if !ok {
+		return nil
+	}
+	if attempts.Failures <= 1 {
+		delete(m.attempts, key)
+		return nil
+	}
+	attempts.Failures--
+	attempts.LastFailure = attempts.PreviousFailure
+	m.attempts[key] = attempts
+	return nil
+}
+
+func (m *Memory) ResetLoginAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *Memory) PruneLoginAttempts(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prune(before), nil
+}
+
+// prune deletes the attempts failed until since. Besides on PruneLoginAttempts
+// it runs whenever the keys doubled, so that a flood of clients costs amortised
+// constant time.
+func (m *Memory) prune(since time.Time) int64 {
+	var pruned int64
+	for key, attempts := range m.attempts {
+		if !attempts.LastFailure.After(since) {
+			delete(m.attempts, key)
+			pruned++
+		}
+	}
+	return pruned
+}
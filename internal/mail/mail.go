@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mail.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// File appends mail to an mbox file instead of sending it, for local testing.
+type File struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFile(path string, from string) *File {
+	return &File{path: path, from: from}
+}
+
+func (f *File) Send(_ context.Context, m Message) error {
+	now := time.Now()
+	msg, err := format(f.from, m, now, "\n")
+	if err != nil {
+		return err
+	}
+	// Body lines starting with From would start a new message of the mbox.
+	msg = bytes.ReplaceAll(msg, []byte("\nFrom "), []byte("\n>From "))
+	sender := f.from
+	if addr, err := netmail.ParseAddress(f.from); err == nil {
+		sender = addr.Address
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "From %s %s\n%s\n", sender, now.UTC().Format(time.ANSIC), msg)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Log logs mail instead of sending it, for local testing.
+type Log struct {
+	Logger *slog.Logger
+}
+
+func (l Log) Send(_ context.Context, m Message) error {
+	l.Logger.Info("Mail", "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
+
+// format renders m as an RFC 5322 message with lines ending in newline.
+func format(from string, m Message, date time.Time, newline string) ([]byte, error) {
+	if strings.ContainsAny(from+m.To, "\r\n") {
+		return nil, errors.New("line break in mail address")
+	}
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + newline)
+	}
+	header("From", from)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString(newline)
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", newline))
+	return b.Bytes(), nil
+}
@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"log/slog"
+	"time"
+)
+
+// Outbox keeps mail until it is sent, see database.FilmbaseRepository.
+type Outbox interface {
+	ClaimMail(limit int, lease time.Duration) ([]database.Mail, error)
+	MarkMailSent(id int64) error
+	MarkMailFailed(id int64, reason string, retryAt *time.Time) error
+}
+
+// WorkerOptions are how the mail of an outbox is sent.
+type WorkerOptions struct {
+	// BatchSize is the number of messages claimed at once.
+	BatchSize int
+	// SendTimeout bounds sending a single message.
+	SendTimeout time.Duration
+	// MaxAttempts is the number of attempts after which a message is given up on.
+	MaxAttempts int
+	// BaseDelay is the delay before the second attempt, doubled after every
+	// further failed attempt up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Worker sends the mail queued in an outbox, retrying failed messages.
+type Worker struct {
+	outbox Outbox
+	mailer Mailer
+	opts   WorkerOptions
+	logger *slog.Logger
+}
+
+func NewWorker(outbox Outbox, mailer Mailer, opts WorkerOptions, logger *slog.Logger) *Worker {
+	return &Worker{outbox: outbox, mailer: mailer, opts: opts, logger: logger}
+}
+
+// Run sends the queued mail every interval until ctx is done.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sent, err := w.Flush(ctx)
+		if err != nil {
+			w.logger.Error(fmt.Sprintf("Error sending mail: %s", err))
+		}
+		if sent > 0 {
+			w.logger.Debug(fmt.Sprintf("Sent %d mails", sent))
+		}
+	}
+}
+
+// Flush sends the mail that is due, batch by batch, and returns how many
+// messages were sent. Failing to send a message does not fail the flush.
+func (w *Worker) Flush(ctx context.Context) (int, error) {
+	// Messages of a batch are sent one by one, the lease must outlast them all.
+	lease := time.Duration(w.opts.BatchSize) * w.opts.SendTimeout
+	sent := 0
+	for ctx.Err() == nil {
+		batch, err := w.outbox.ClaimMail(w.opts.BatchSize, lease)
+		if err != nil {
+			return sent, err
+		}
+		for _, m := range batch {
+			ok, err := w.send(ctx, m)
+			if err != nil {
+				return sent, err
+			}
+			if ok {
+				sent++
+			}
+		}
+		if len(batch) < w.opts.BatchSize {
+			break
+		}
+	}
+	return sent, nil
+}
+
+// send sends m and records the outcome, reporting whether m was sent. It only
+// fails when the outcome cannot be recorded.
+func (w *Worker) send(ctx context.Context, m database.Mail) (bool, error) {
+	sendCtx, cancel := context.WithTimeout(ctx, w.opts.SendTimeout)
+	defer cancel()
+	err := w.mailer.Send(sendCtx, Message{To: m.Recipient, Subject: m.Subject, Body: m.Body})
+	if err == nil {
+		return true, w.outbox.MarkMailSent(m.ID)
+	}
+	attempts := m.Attempts + 1
+	if attempts >= w.opts.MaxAttempts {
+		w.logger.Error(fmt.Sprintf("Giving up on mail %d to %s after %d attempts: %s", m.ID, m.Recipient, attempts, err))
+		return false, w.outbox.MarkMailFailed(m.ID, err.Error(), nil)
+	}
+	retryAt := time.Now().Add(w.retryDelay(attempts))
+	w.logger.Warn(fmt.Sprintf("Error sending mail %d to %s, retrying at %s: %s", m.ID, m.Recipient, retryAt.Format(time.RFC3339), err))
+	return false, w.outbox.MarkMailFailed(m.ID, err.Error(), &retryAt)
+}
+
+// retryDelay returns the delay after the failed attempts.
+func (w *Worker) retryDelay(attempts int) time.Duration {
+	delay := w.opts.BaseDelay
+	for i := 1; i < attempts && delay < w.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, w.opts.MaxDelay)
+}
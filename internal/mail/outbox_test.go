@@ -0,0 +1,113 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outbox is an Outbox in memory, every message is due until it is marked.
+type outbox struct {
+	mail    []database.Mail
+	sent    []int64
+	retries map[int64]*time.Time
+}
+
+func (o *outbox) ClaimMail(limit int, _ time.Duration) ([]database.Mail, error) {
+	var due []database.Mail
+	for _, m := range o.mail {
+		if _, failed := o.retries[m.ID]; failed || len(due) == limit {
+			continue
+		}
+		if !containsID(o.sent, m.ID) {
+			due = append(due, m)
+		}
+	}
+	return due, nil
+}
+
+func (o *outbox) MarkMailSent(id int64) error {
+	o.sent = append(o.sent, id)
+	return nil
+}
+
+func (o *outbox) MarkMailFailed(id int64, _ string, retryAt *time.Time) error {
+	o.retries[id] = retryAt
+	return nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+type mailer func(m Message) error
+
+func (f mailer) Send(_ context.Context, m Message) error {
+	return f(m)
+}
+
+var workerOptions = WorkerOptions{BatchSize: 2, SendTimeout: time.Second, MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+func TestWorker_ShouldSendEveryBatchAndRetryFailures(t *testing.T) {
+	store := &outbox{retries: make(map[int64]*time.Time)}
+	for id := int64(1); id <= 5; id++ {
+		store.mail = append(store.mail, database.Mail{ID: id, Recipient: "user@example.com"})
+	}
+	store.mail[4].Attempts = 2
+	worker := NewWorker(store, mailer(func(m Message) error {
+		return errors.New("unavailable")
+	}), workerOptions, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	sent, err := worker.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Len(t, store.retries, 5)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *store.retries[1], time.Second)
+	assert.Nil(t, store.retries[5], "given up on after the last attempt")
+
+	store.retries = make(map[int64]*time.Time)
+	worker.mailer = mailer(func(m Message) error { return nil })
+	sent, err = worker.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, sent)
+}
+
+func TestWorker_ShouldBackOffExponentially(t *testing.T) {
+	worker := NewWorker(nil, nil, workerOptions, nil)
+	assert.Equal(t, time.Minute, worker.retryDelay(1))
+	assert.Equal(t, 4*time.Minute, worker.retryDelay(3))
+	assert.Equal(t, time.Hour, worker.retryDelay(10))
+}
+
+func TestFile_ShouldAppendToMbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.mbox")
+	file := NewFile(path, "Filmbase <noreply@example.com>")
+	for _, body := range []string{"first\nFrom here on", "second"} {
+		if err := file.Send(context.Background(), Message{To: "user@example.com", Subject: "Bienvenue à filmbase", Body: body}); err != nil {
+			t.Fatalf("test failed: %s", err)
+		}
+	}
+	mbox, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	assert.Equal(t, 2, strings.Count(string(mbox), "\nFrom noreply@example.com ")+1)
+	assert.Contains(t, string(mbox), "\n>From here on")
+	assert.Contains(t, string(mbox), "Subject: =?utf-8?q?Bienvenue_=C3=A0_filmbase?=")
+
+	err = file.Send(context.Background(), Message{To: "user@example.com\r\nBcc: other@example.com"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends mail through an SMTP server. The connection is upgraded with
+// STARTTLS when the server supports it, and credentials are only sent over TLS.
+type SMTP struct {
+	// Address is the host:port of the server.
+	Address  string
+	Username string
+	// Password returns the current password, so that it can be rotated.
+	Password func() string
+	// From is the sender address, optionally with a name, e.g.
+	// "Filmbase <noreply@example.com>".
+	From string
+}
+
+func (s SMTP) Send(ctx context.Context, m Message) error {
+	msg, err := format(s.From, m, time.Now(), "\r\n")
+	if err != nil {
+		return err
+	}
+	from, err := netmail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.Address)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		// PlainAuth refuses to send the password over plain connections
+		// except to localhost.
+		if err = client.Auth(smtp.PlainAuth("", s.Username, s.Password(), host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
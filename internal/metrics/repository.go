@@ -0,0 +1,306 @@
+package metrics
+
+import (
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+// Repository records the duration and the errors of every call to the wrapped
+// database.FilmbaseRepository.
+type Repository struct {
+	database.FilmbaseRepository
+}
+
+func NewRepository(repository database.FilmbaseRepository) *Repository {
+	return &Repository{FilmbaseRepository: repository}
+}
+
+func (m *Repository) Ping() (err error) {
+	defer func(start time.Time) { ObserveQuery("Ping", start, err) }(time.Now())
+	return m.FilmbaseRepository.Ping()
+}
+
+func (m *Repository) MigrationVersion() (version int, expected int, err error) {
+	defer func(start time.Time) { ObserveQuery("MigrationVersion", start, err) }(time.Now())
+	return m.FilmbaseRepository.MigrationVersion()
+}
+
+func (m *Repository) PostActor(actor database.Actor) (id int64, err error) {
+	defer func(start time.Time) { ObserveQuery("PostActor", start, err) }(time.Now())
+	return m.FilmbaseRepository.PostActor(actor)
+}
+
+func (m *Repository) PutActor(actor database.Actor) (err error) {
+	defer func(start time.Time) { ObserveQuery("PutActor", start, err) }(time.Now())
+	return m.FilmbaseRepository.PutActor(actor)
+}
+
+func (m *Repository) DeleteActorById(actorId int64) (err error) {
+	defer func(start time.Time) { ObserveQuery("DeleteActorById", start, err) }(time.Now())
+	return m.FilmbaseRepository.DeleteActorById(actorId)
+}
+
+func (m *Repository) GetActorFilms() (films []database.ActorFilm, err error) {
+	defer func(start time.Time) { ObserveQuery("GetActorFilms", start, err) }(time.Now())
+	return m.FilmbaseRepository.GetActorFilms()
+}
+
+func (m *Repository) PostActorFilm(actorId, filmId int64) (err error) {
+	defer func(start time.Time) { ObserveQuery("PostActorFilm", start, err) }(time.Now())
+	return m.FilmbaseRepository.PostActorFilm(actorId, filmId)
+}
+
+func (m *Repository) GetFilmSearch(filmName string, actorName string, sortBy string, sortKey string) (films []database.ActorFilm, err error) {
+	defer func(start time.Time) { ObserveQuery("GetFilmSearch", start, err) }(time.Now())
+	return m.FilmbaseRepository.GetFilmSearch(filmName, actorName, sortBy, sortKey)
+}
+
+func (m *Repository) GetFilm(sortBy string, sortKey string) (films []database.Film, err error) {
+	defer func(start time.Time) { ObserveQuery("GetFilm", start, err) }(time.Now())
+	return m.FilmbaseRepository.GetFilm(sortBy, sortKey)
+}
+
+func (m *Repository) PostFilm(film database.Film) (id int64, err error) {
+	defer func(start time.Time) { ObserveQuery("PostFilm", start, err) }(time.Now())
+	return m.FilmbaseRepository.PostFilm(film)
+}
+
+func (m *Repository) PutFilm(film database.Film) (err error) {
+	defer func(start time.Time) { ObserveQuery("PutFilm", start, err) }(time.Now())
+	return m.FilmbaseRepository.PutFilm(film)
+}
+
+func (m *Repository) DeleteFilmById(filmId int64) (err error) {
+	defer func(start time.Time) { ObserveQuery("DeleteFilmById", start, err) }(time.Now())
+	return m.FilmbaseRepository.DeleteFilmById(filmId)
+}
+
+func (m *Repository) UserCredentials(username string) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("UserCredentials", start, err) }(time.Now())
+	return m.FilmbaseRepository.UserCredentials(username)
+}
+
+func (m *Repository) SetUserPassword(username string, hash string) (err error) {
+	defer func(start time.Time) { ObserveQuery("SetUserPassword", start, err) }(time.Now())
+	return m.FilmbaseRepository.SetUserPassword(username, hash)
+}
+
+func (m *Repository) Signup(username string, password string, role string, email string) (err error) {
+	defer func(start time.Time) { ObserveQuery("Signup", start, err) }(time.Now())
+	return m.FilmbaseRepository.Signup(username, password, role, email)
+}
+
+func (m *Repository) ListUsers() (users []database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("ListUsers", start, err) }(time.Now())
+	return m.FilmbaseRepository.ListUsers()
+}
+
+func (m *Repository) SetUserRole(username string, role string) (err error) {
+	defer func(start time.Time) { ObserveQuery("SetUserRole", start, err) }(time.Now())
+	return m.FilmbaseRepository.SetUserRole(username, role)
+}
+
+func (m *Repository) SetUserDisabled(username string, disabled bool) (err error) {
+	defer func(start time.Time) { ObserveQuery("SetUserDisabled", start, err) }(time.Now())
+	return m.FilmbaseRepository.SetUserDisabled(username, disabled)
+}
+
+func (m *Repository) DeleteUser(username string) (err error) {
+	defer func(start time.Time) { ObserveQuery("DeleteUser", start, err) }(time.Now())
+	return m.FilmbaseRepository.DeleteUser(username)
+}
+
+func (m *Repository) CreateRefreshToken(token database.RefreshToken) (err error) {
+	defer func(start time.Time) { ObserveQuery("CreateRefreshToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.CreateRefreshToken(token)
+}
+
+func (m *Repository) RotateRefreshToken(hash string, next database.RefreshToken) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("RotateRefreshToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.RotateRefreshToken(hash, next)
+}
+
+func (m *Repository) RevokeRefreshToken(hash string, username string) (err error) {
+	defer func(start time.Time) { ObserveQuery("RevokeRefreshToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.RevokeRefreshToken(hash, username)
+}
+
+func (m *Repository) RevokeToken(jti string, expiresAt time.Time) (err error) {
+	defer func(start time.Time) { ObserveQuery("RevokeToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.RevokeToken(jti, expiresAt)
+}
+
+func (m *Repository) RevokeUserTokens(username string) (err error) {
+	defer func(start time.Time) { ObserveQuery("RevokeUserTokens", start, err) }(time.Now())
+	return m.FilmbaseRepository.RevokeUserTokens(username)
+}
+
+func (m *Repository) IsTokenRevoked(jti string, username string, issuedAt time.Time) (revoked bool, err error) {
+	defer func(start time.Time) { ObserveQuery("IsTokenRevoked", start, err) }(time.Now())
+	return m.FilmbaseRepository.IsTokenRevoked(jti, username, issuedAt)
+}
+
+func (m *Repository) PruneTokens() (pruned int64, err error) {
+	defer func(start time.Time) { ObserveQuery("PruneTokens", start, err) }(time.Now())
+	return m.FilmbaseRepository.PruneTokens()
+}
+
+func (m *Repository) SigningKeys(retiredAfter time.Time) (keys []database.SigningKey, err error) {
+	defer func(start time.Time) { ObserveQuery("SigningKeys", start, err) }(time.Now())
+	return m.FilmbaseRepository.SigningKeys(retiredAfter)
+}
+
+func (m *Repository) CreateSigningKey(key database.SigningKey) (err error) {
+	defer func(start time.Time) { ObserveQuery("CreateSigningKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.CreateSigningKey(key)
+}
+
+func (m *Repository) CreateFirstSigningKey(key database.SigningKey) (created bool, err error) {
+	defer func(start time.Time) { ObserveQuery("CreateFirstSigningKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.CreateFirstSigningKey(key)
+}
+
+func (m *Repository) UpdateSigningKey(id string, privateKey []byte) (err error) {
+	defer func(start time.Time) { ObserveQuery("UpdateSigningKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.UpdateSigningKey(id, privateKey)
+}
+
+func (m *Repository) RetireSigningKey(id string) (err error) {
+	defer func(start time.Time) { ObserveQuery("RetireSigningKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.RetireSigningKey(id)
+}
+
+func (m *Repository) CreateAPIKey(key database.APIKey) (err error) {
+	defer func(start time.Time) { ObserveQuery("CreateAPIKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.CreateAPIKey(key)
+}
+
+func (m *Repository) ListAPIKeys() (keys []database.APIKey, err error) {
+	defer func(start time.Time) { ObserveQuery("ListAPIKeys", start, err) }(time.Now())
+	return m.FilmbaseRepository.ListAPIKeys()
+}
+
+func (m *Repository) APIKey(prefix string) (key database.APIKey, err error) {
+	defer func(start time.Time) { ObserveQuery("APIKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.APIKey(prefix)
+}
+
+func (m *Repository) TouchAPIKey(prefix string) (err error) {
+	defer func(start time.Time) { ObserveQuery("TouchAPIKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.TouchAPIKey(prefix)
+}
+
+func (m *Repository) DeleteAPIKey(prefix string) (err error) {
+	defer func(start time.Time) { ObserveQuery("DeleteAPIKey", start, err) }(time.Now())
+	return m.FilmbaseRepository.DeleteAPIKey(prefix)
+}
+
+func (m *Repository) ProvisionUser(username string, provider string, role string) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("ProvisionUser", start, err) }(time.Now())
+	return m.FilmbaseRepository.ProvisionUser(username, provider, role)
+}
+
+func (m *Repository) RecordLoginAttempt(key string, at time.Time, since time.Time) (attempts database.LoginAttempts, err error) {
+	defer func(start time.Time) { ObserveQuery("RecordLoginAttempt", start, err) }(time.Now())
+	return m.FilmbaseRepository.RecordLoginAttempt(key, at, since)
+}
+
+func (m *Repository) ForgiveLoginAttempt(key string) (err error) {
+	defer func(start time.Time) { ObserveQuery("ForgiveLoginAttempt", start, err) }(time.Now())
+	return m.FilmbaseRepository.ForgiveLoginAttempt(key)
+}
+
+func (m *Repository) ResetLoginAttempts(key string) (err error) {
+	defer func(start time.Time) { ObserveQuery("ResetLoginAttempts", start, err) }(time.Now())
+	return m.FilmbaseRepository.ResetLoginAttempts(key)
+}
+
+func (m *Repository) AuditFailedLogin(login database.FailedLogin) (err error) {
+	defer func(start time.Time) { ObserveQuery("AuditFailedLogin", start, err) }(time.Now())
+	return m.FilmbaseRepository.AuditFailedLogin(login)
+}
+
+func (m *Repository) PruneLoginAttempts(before time.Time) (pruned int64, err error) {
+	defer func(start time.Time) { ObserveQuery("PruneLoginAttempts", start, err) }(time.Now())
+	return m.FilmbaseRepository.PruneLoginAttempts(before)
+}
+
+func (m *Repository) UserByEmail(email string) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("UserByEmail", start, err) }(time.Now())
+	return m.FilmbaseRepository.UserByEmail(email)
+}
+
+func (m *Repository) CreateUserToken(token database.UserToken, mail database.Mail) (err error) {
+	defer func(start time.Time) { ObserveQuery("CreateUserToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.CreateUserToken(token, mail)
+}
+
+func (m *Repository) UserToken(hash string, purpose string) (token database.UserToken, err error) {
+	defer func(start time.Time) { ObserveQuery("UserToken", start, err) }(time.Now())
+	return m.FilmbaseRepository.UserToken(hash, purpose)
+}
+
+func (m *Repository) ResetPassword(hash string, password string) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("ResetPassword", start, err) }(time.Now())
+	return m.FilmbaseRepository.ResetPassword(hash, password)
+}
+
+func (m *Repository) VerifyEmail(hash string) (user database.User, err error) {
+	defer func(start time.Time) { ObserveQuery("VerifyEmail", start, err) }(time.Now())
+	return m.FilmbaseRepository.VerifyEmail(hash)
+}
+
+func (m *Repository) ClaimMail(limit int, lease time.Duration) (mail []database.Mail, err error) {
+	defer func(start time.Time) { ObserveQuery("ClaimMail", start, err) }(time.Now())
+	return m.FilmbaseRepository.ClaimMail(limit, lease)
+}
+
+func (m *Repository) MarkMailSent(id int64) (err error) {
+	defer func(start time.Time) { ObserveQuery("MarkMailSent", start, err) }(time.Now())
+	return m.FilmbaseRepository.MarkMailSent(id)
+}
+
+func (m *Repository) MarkMailFailed(id int64, reason string, retryAt *time.Time) (err error) {
+	defer func(start time.Time) { ObserveQuery("MarkMailFailed", start, err) }(time.Now())
+	return m.FilmbaseRepository.MarkMailFailed(id, reason, retryAt)
+}
+
+func (m *Repository) PruneMail(before time.Time) (pruned int64, err error) {
+	defer func(start time.Time) { ObserveQuery("PruneMail", start, err) }(time.Now())
+	return m.FilmbaseRepository.PruneMail(before)
+}
+
+func (m *Repository) TOTP(username string) (totp database.TOTP, err error) {
+	defer func(start time.Time) { ObserveQuery("TOTP", start, err) }(time.Now())
+	return m.FilmbaseRepository.TOTP(username)
+}
+
+func (m *Repository) BeginTOTP(username string, secret string) (err error) {
+	defer func(start time.Time) { ObserveQuery("BeginTOTP", start, err) }(time.Now())
+	return m.FilmbaseRepository.BeginTOTP(username, secret)
+}
+
+func (m *Repository) ConfirmTOTP(username string, step int64, hashes []string) (err error) {
+	defer func(start time.Time) { ObserveQuery("ConfirmTOTP", start, err) }(time.Now())
+	return m.FilmbaseRepository.ConfirmTOTP(username, step, hashes)
+}
+
+func (m *Repository) UseTOTPStep(username string, step int64) (err error) {
+	defer func(start time.Time) { ObserveQuery("UseTOTPStep", start, err) }(time.Now())
+	return m.FilmbaseRepository.UseTOTPStep(username, step)
+}
+
+func (m *Repository) UseRecoveryCode(username string, hash string) (err error) {
+	defer func(start time.Time) { ObserveQuery("UseRecoveryCode", start, err) }(time.Now())
+	return m.FilmbaseRepository.UseRecoveryCode(username, hash)
+}
+
+func (m *Repository) SetRecoveryCodes(username string, hashes []string) (err error) {
+	defer func(start time.Time) { ObserveQuery("SetRecoveryCodes", start, err) }(time.Now())
+	return m.FilmbaseRepository.SetRecoveryCodes(username, hashes)
+}
+
+func (m *Repository) DeleteTOTP(username string) (err error) {
+	defer func(start time.Time) { ObserveQuery("DeleteTOTP", start, err) }(time.Now())
+	return m.FilmbaseRepository.DeleteTOTP(username)
+}
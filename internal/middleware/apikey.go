@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader is the header API keys are sent in.
+const APIKeyHeader = "X-API-Key"
+
+// MethodAPIKey is the Identity.Method of requests authenticated by an API key.
+// Their username is "apikey:" and the prefix of the key, which no user is
+// named after, as a key is no user.
+const MethodAPIKey = "api_key"
+
+type scopesKey struct{}
+
+// APIKeys looks up API keys by their prefix.
+type APIKeys interface {
+	APIKey(prefix string) (database.APIKey, error)
+	TouchAPIKey(prefix string) error
+}
+
+// APIKeyAuthenticator authenticates requests by an API key in the X-API-Key
+// header, as an alternative to bearer tokens. The request gets the role of
+// the key and is restricted to its scopes.
+func APIKeyAuthenticator(keys APIKeys) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (Identity, error) {
+		value := r.Header.Get(APIKeyHeader)
+		if value == "" {
+			return Identity{}, ErrNoCredentials
+		}
+		key, err := lookupAPIKey(keys, value)
+		if errors.Is(err, database.ErrAPIKeyNotFound) {
+			return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+		}
+		if err != nil {
+			return Identity{}, fmt.Errorf("looking up api key: %w", err)
+		}
+		if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+			return Identity{}, fmt.Errorf("%w: api key %s expired", ErrInvalidCredentials, key.Prefix)
+		}
+		// Its last use is informational, a failure to record it does not reject the key.
+		_ = keys.TouchAPIKey(key.Prefix)
+		return Identity{Username: "apikey:" + key.Prefix, Role: key.Role, Scopes: strings.Fields(key.Scopes), Method: MethodAPIKey}, nil
+	})
+}
+
+// lookupAPIKey returns the stored key value is, comparing hashes in constant time.
+func lookupAPIKey(keys APIKeys, value string) (database.APIKey, error) {
+	prefix, ok := auth.ParseAPIKey(value)
+	if !ok {
+		return database.APIKey{}, database.ErrAPIKeyNotFound
+	}
+	key, err := keys.APIKey(prefix)
+	if err != nil {
+		return database.APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(auth.HashToken(value))) != 1 {
+		return database.APIKey{}, database.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// restrictedScopes returns the scopes the credentials of the request are
+// restricted to beyond its role, if any.
+func restrictedScopes(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(scopesKey{}).([]string)
+	return scopes, ok
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type apiKeys map[string]database.APIKey
+
+func (k apiKeys) APIKey(prefix string) (database.APIKey, error) {
+	key, ok := k[prefix]
+	if !ok {
+		return key, database.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (k apiKeys) TouchAPIKey(prefix string) error {
+	return nil
+}
+
+func newAPIKey(t *testing.T, keys apiKeys, role, scopes string, expiresAt *time.Time) string {
+	value, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	keys[prefix] = database.APIKey{Prefix: prefix, Hash: hash, Name: "batch", Role: role, Scopes: scopes, ExpiresAt: expiresAt}
+	return value
+}
+
+func TestAPIKey_ShouldAuthenticateAndRestrictScopes(t *testing.T) {
+	keys := apiKeys{}
+	full := newAPIKey(t, keys, "admin", "", nil)
+	readOnly := newAPIKey(t, keys, "admin", "read", nil)
+	p := policy.Parse(map[string]string{"admin": "read write admin"})
+	var username any
+	handler := Authenticate(JWTAuthenticator(nil), APIKeyAuthenticator(keys))(Authorize(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username = r.Context().Value("username")
+	})))
+	serve := func(key string, scopes ...string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/film", nil)
+		req.Header.Set(APIKeyHeader, key)
+		// Scopes are declared by the operation wrapper before the middlewares run.
+		handler.ServeHTTP(recorder, req.WithContext(withScopes(req, scopes)))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(full, policy.ScopeWrite))
+	prefix, _ := auth.ParseAPIKey(full)
+	assert.Equal(t, "apikey:"+prefix, username)
+	assert.Equal(t, http.StatusOK, serve(readOnly, policy.ScopeRead))
+	assert.Equal(t, http.StatusForbidden, serve(readOnly, policy.ScopeWrite))
+}
+
+func TestAPIKey_ShouldRejectUnknownAndExpiredKeys(t *testing.T) {
+	keys := apiKeys{}
+	expired := time.Now().Add(-time.Minute)
+	expiredKey := newAPIKey(t, keys, "admin", "", &expired)
+	valid := newAPIKey(t, keys, "admin", "", nil)
+	handler := Authenticate(JWTAuthenticator(nil), APIKeyAuthenticator(keys))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, key := range []string{expiredKey, valid + "x", "fb_unknown_secret", "garbage"} {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		req.Header.Set(APIKeyHeader, key)
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, key)
+	}
+}
+
+func withScopes(r *http.Request, scopes []string) context.Context {
+	return context.WithValue(r.Context(), policy.ScopesContextKey, scopes)
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request carries
+	// no credentials it handles, so that the next one is tried.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is wrapped by the errors of an Authenticator that
+	// rejects the credentials of the request.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Username string
+	Role     string
+	// Scopes restrict the request beyond its role when set.
+	Scopes []string
+	// Method is how the request was authenticated, e.g. "jwt".
+	Method string
+	// TokenID and ExpiresAt identify the access token of the request, if any,
+	// so that it can be revoked.
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Authenticator authenticates requests by one kind of credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// AuthenticatorFunc is a function used as an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Identity, error) {
+	return f(r)
+}
+
+// Authenticate authenticates requests by the first of authenticators that
+// handles their credentials. Requests that none of them handles are rejected,
+// unless an earlier middleware authenticated them. Rejections carry a Bearer
+// challenge as of RFC 6750: 401 without or with invalid credentials, 400 with
+// malformed ones.
+func Authenticate(authenticators ...Authenticator) MiddlewareFunc {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authenticated(r.Context()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := Logger(r.Context(), logger)
+			encoder := json.NewEncoder(w)
+			for _, authenticator := range authenticators {
+				identity, err := authenticator.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if errors.Is(err, ErrInvalidRequest) {
+					logger.Debug(fmt.Sprintf("Request discarded: auth failed: %s", err))
+					challenge(w, "invalid_request", nil)
+					returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %s", err))
+					return
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					logger.Debug(fmt.Sprintf("Request discarded: auth failed: %s", err))
+					challenge(w, "invalid_token", nil)
+					returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+					return
+				}
+				if err != nil {
+					logger.Error(fmt.Sprintf("Request discarded: authenticating: %s", err))
+					returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error"))
+					return
+				}
+				if usesTokenHeader(r) {
+					w.Header().Set("Deprecation", "true")
+					LogWith(r.Context(), "deprecated", "token header")
+				}
+				ctx := withIdentity(r.Context(), identity)
+				logger.Debug(fmt.Sprintf("User with claims %s authenticated by %s", identity.Role, identity.Method))
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			logger.Debug("Request discarded: auth failed: credentials absent")
+			challenge(w, "", nil)
+			returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		})
+	}
+}
+
+func withIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = context.WithValue(ctx, "role", identity.Role)
+	ctx = context.WithValue(ctx, "username", identity.Username)
+	if identity.TokenID != "" {
+		ctx = context.WithValue(ctx, "jti", identity.TokenID)
+		ctx = context.WithValue(ctx, "exp", identity.ExpiresAt)
+	}
+	if len(identity.Scopes) > 0 {
+		ctx = context.WithValue(ctx, scopesKey{}, identity.Scopes)
+	}
+	ctx = context.WithValue(ctx, authenticatedKey{}, identity.Method)
+	LogWith(ctx, "user", identity.Username, "role", identity.Role, "auth", identity.Method)
+	return ctx
+}
+
+// JWTAuthenticator authenticates requests by an access token issued by this
+// service in the Authorization header, rejecting tokens found in revocations. A nil
+// revocations checks none. Tokens of other issuers are left to the next
+// authenticator.
+func JWTAuthenticator(revocations Revocations) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (Identity, error) {
+		token, err := bearerToken(r)
+		if err != nil {
+			return Identity{}, err
+		}
+		if iss := auth.TokenIssuer(token); iss != "" && iss != strings.TrimSuffix(auth.Settings().Issuer, "/") {
+			return Identity{}, ErrNoCredentials
+		}
+		claims, err := auth.ParseJWT(token)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+		}
+		identity := Identity{Method: "jwt", TokenID: claimString(claims, "jti"), ExpiresAt: claimTime(claims, "exp")}
+		identity.Role = claimString(claims, "role")
+		identity.Username = claimString(claims, "username")
+		if identity.TokenID == "" {
+			return Identity{}, fmt.Errorf("%w: token without id", ErrInvalidCredentials)
+		}
+		return identity, checkRevoked(revocations, identity, claimTime(claims, "iat"))
+	})
+}
+
+// checkRevoked returns an error if the token of identity issued at issuedAt
+// was found in revocations.
+func checkRevoked(revocations Revocations, identity Identity, issuedAt time.Time) error {
+	if revocations == nil {
+		return nil
+	}
+	revoked, err := revocations.IsTokenRevoked(identity.TokenID, identity.Username, issuedAt)
+	if err != nil {
+		return fmt.Errorf("checking token revocation: %w", err)
+	}
+	if revoked {
+		return fmt.Errorf("%w: token revoked", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+func claimString(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/policy"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// Authorize rejects requests whose role is not granted every scope the
+// operation declares under policy.ScopesContextKey, or whose API key is
+// restricted to fewer scopes. An operation declaring no scopes at all is
+// rejected too, only an empty list lets any authenticated user in. It must run
+// after the request was authenticated, so it comes first in the middleware
+// list.
+func Authorize(p *policy.Policy) MiddlewareFunc {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			required, declared := r.Context().Value(policy.ScopesContextKey).([]string)
+			role, _ := r.Context().Value("role").(string)
+			allowed := declared && p.Allows(role, required)
+			if scopes, ok := restrictedScopes(r.Context()); ok {
+				allowed = allowed && policy.New(map[string][]string{role: scopes}).Allows(role, required)
+			}
+			if !allowed {
+				Logger(r.Context(), logger).Info(fmt.Sprintf("Request discarded: forbidden: role %q lacks scopes %v", role, required))
+				challenge(w, "insufficient_scope", required)
+				returnResponse(w, *json.NewEncoder(w), http.StatusForbidden, nil, fmt.Errorf("forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Realm is the protection space of the challenges in WWW-Authenticate headers.
+const Realm = "filmbase"
+
+// ErrInvalidRequest is wrapped by the errors of an Authenticator that cannot
+// read malformed credentials.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// bearerToken returns the access token of r from the Authorization header
+// (RFC 6750), or from the deprecated Token header when the Authorization
+// header is absent.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		token := r.Header.Get("Token")
+		if token == "" {
+			return "", ErrNoCredentials
+		}
+		return token, nil
+	}
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrNoCredentials
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", fmt.Errorf("%w: malformed bearer token", ErrInvalidRequest)
+	}
+	return token, nil
+}
+
+// usesTokenHeader reports whether r authenticates with the deprecated Token header.
+func usesTokenHeader(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "" && r.Header.Get("Token") != ""
+}
+
+// challenge sets the WWW-Authenticate header of a response rejecting a
+// request, with the error code of RFC 6750 section 3.1 unless it is empty.
+func challenge(w http.ResponseWriter, code string, scopes []string) {
+	value := fmt.Sprintf("Bearer realm=%q", Realm)
+	if code != "" {
+		value += fmt.Sprintf(", error=%q", code)
+	}
+	if len(scopes) > 0 {
+		value += fmt.Sprintf(", scope=%q", strings.Join(scopes, " "))
+	}
+	w.Header().Set("WWW-Authenticate", value)
+}
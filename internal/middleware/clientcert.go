@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// authenticatedKey holds how the request was authenticated, see Identity.Method.
+type authenticatedKey struct{}
+
+// ClientCert authenticates requests carrying a verified client certificate
+// whose names are mapped to a role, as an alternative to bearer tokens. roles
+// is keyed by the subject alternative names of the certificate, prefixed with
+// their type as in "dns:batch.example.com", "email:batch@example.com" or
+// "uri:spiffe://example.com/batch", or by its full subject as in
+// "dn:CN=batch,O=Filmbase". The common name alone is not matched, since any
+// CA in the chain may issue it to anyone. The matched key is the username, so
+// it cannot be mistaken for a local user. Client certificates cannot answer a
+// one-time password, so roles should not require one. Requests without a
+// mapped certificate pass through unauthenticated.
+func ClientCert(roles map[string]string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var username, role string
+			for _, name := range certificateNames(r.TLS.VerifiedChains[0][0]) {
+				if mapped, ok := roles[name]; ok {
+					username, role = name, mapped
+					break
+				}
+			}
+			if username == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "role", role)
+			ctx = context.WithValue(ctx, "username", username)
+			ctx = context.WithValue(ctx, authenticatedKey{}, "client_cert")
+			LogWith(ctx, "user", username, "role", role, "auth", "client_cert")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// certificateNames returns the names of cert as keyed by ClientCert, the full
+// subject first.
+func certificateNames(cert *x509.Certificate) []string {
+	names := []string{"dn:" + cert.Subject.String()}
+	for _, name := range cert.DNSNames {
+		names = append(names, "dns:"+name)
+	}
+	for _, address := range cert.EmailAddresses {
+		names = append(names, "email:"+address)
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, "uri:"+uri.String())
+	}
+	return names
+}
+
+// authenticated reports whether an earlier middleware authenticated the request.
+func authenticated(ctx context.Context) bool {
+	return AuthMethod(ctx) != ""
+}
+
+// AuthMethod returns how the request was authenticated, e.g. "jwt", or
+// MethodAPIKey for an API key, and "" when it was not.
+func AuthMethod(ctx context.Context) string {
+	method, _ := ctx.Value(authenticatedKey{}).(string)
+	return method
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientCert_ShouldMapNamesToRole(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/reports")
+	roles := map[string]string{"dn:CN=batch,O=Filmbase": "admin", "dns:batch.example.com": "admin", "uri:spiffe://example.com/reports": "user"}
+	var role, username any
+	handler := ClientCert(roles)(VerifyJWT(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role = r.Context().Value("role")
+		username = r.Context().Value("username")
+	})))
+	tests := []struct {
+		cert     x509.Certificate
+		username string
+		role     string
+	}{
+		{x509.Certificate{Subject: pkix.Name{CommonName: "batch", Organization: []string{"Filmbase"}}}, "dn:CN=batch,O=Filmbase", "admin"},
+		{x509.Certificate{Subject: pkix.Name{CommonName: "other"}, DNSNames: []string{"batch.example.com"}}, "dns:batch.example.com", "admin"},
+		{x509.Certificate{URIs: []*url.URL{spiffe}}, "uri:spiffe://example.com/reports", "user"},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{&test.cert}}}
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code, test.username)
+		assert.Equal(t, test.role, role, test.username)
+		assert.Equal(t, test.username, username)
+	}
+}
+
+func TestClientCert_ShouldIgnoreCommonName(t *testing.T) {
+	handler := ClientCert(map[string]string{"batch": "admin", "dns:batch": "admin"})(VerifyJWT(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "batch"}}}}}
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
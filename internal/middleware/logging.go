@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds propagated request ids so that clients cannot
+// flood the logs through the header.
+const maxRequestIDLength = 128
+
+type requestLogKey struct{}
+
+// requestLog holds the logger of a request. Middlewares further down the chain
+// add attributes to it, so that the access log line carries them too.
+type requestLog struct {
+	logger *slog.Logger
+	route  string
+}
+
+// RequestLogger assigns or propagates the X-Request-ID of a request and puts a
+// logger annotated with the request id, method and route into its context.
+// Once the request is served an access log line is written with the status
+// and the duration.
+func RequestLogger(logger *slog.Logger, route string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = uuid.NewString()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			rl := &requestLog{logger: logger.With(
+				"request_id", requestID,
+				"method", r.Method,
+				"route", route,
+			), route: r.Method + " " + route}
+			rec := NewResponseRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl)))
+
+			rl.logger.Info("Request served",
+				"status", rec.Status,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		})
+	}
+}
+
+// Logger returns the logger of the request ctx belongs to, or fallback outside
+// of a request.
+func Logger(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.logger
+	}
+	return fallback
+}
+
+// LogWith adds attributes to the logger of the request ctx belongs to.
+func LogWith(ctx context.Context, args ...any) {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		rl.logger = rl.logger.With(args...)
+	}
+}
+
+// LogTrace adds the trace and span id of ctx to the logger of its request, so
+// that the access log line can be correlated with the trace.
+func LogTrace(ctx context.Context) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	LogWith(ctx, "trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+}
+
+// Route returns the method and the route of the request ctx belongs to, e.g.
+// "POST /login", empty outside of a request.
+func Route(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.route
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger_ShouldPropagateRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	handler := RequestLogger(logger, "/film/{filmId}")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LogWith(r.Context(), "user", "test")
+		Logger(r.Context(), nil).Info("handled")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("DELETE", "/film/1", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, "abc", recorder.Header().Get(RequestIDHeader))
+	assert.Contains(t, buf.String(), `"msg":"handled","request_id":"abc","method":"DELETE","route":"/film/{filmId}","user":"test"`)
+	assert.Contains(t, buf.String(), `"msg":"Request served","request_id":"abc","method":"DELETE","route":"/film/{filmId}","user":"test","status":418`)
+}
+
+func TestRequestLogger_ShouldLogTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	handler := RequestLogger(logger, "/film")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LogTrace(trace.ContextWithSpanContext(r.Context(), sc))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/film", nil))
+
+	assert.Contains(t, buf.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7","status":200`)
+}
+
+func TestRequestLogger_ShouldAssignRequestID(t *testing.T) {
+	handler := RequestLogger(slog.Default(), "/film")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/film", nil))
+	assert.Len(t, recorder.Header().Get(RequestIDHeader), 36)
+}
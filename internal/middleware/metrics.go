@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"github.com/Paincake/filmbase/internal/metrics"
+	"net/http"
+	"time"
+)
+
+// Metrics records the request count and latency of a route. route is the
+// pattern the handler is registered with, so that path parameters do not
+// explode the label cardinality.
+func Metrics(route string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := NewResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+			metrics.ObserveRequest(r.Method, route, rec.Status, time.Since(start))
+		})
+	}
+}
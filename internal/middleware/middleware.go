@@ -1,72 +1,57 @@
 package middleware
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
-	"github.com/golang-jwt/jwt"
-	"log/slog"
+	"github.com/Paincake/filmbase/internal/problem"
+	"net"
 	"net/http"
-	"os"
+	"time"
 )
 
 type Response struct {
 	Code         int
-	Error        error
 	ResponseBody any
 }
 
+// returnResponse answers with body, or with err as problem details when err
+// is not nil.
 func returnResponse(w http.ResponseWriter, encoder json.Encoder, code int, body any, err error) {
+	if err != nil {
+		problem.Write(w, code, err)
+		return
+	}
 	w.WriteHeader(code)
 	encoder.Encode(Response{
 		Code:         code,
-		Error:        err,
 		ResponseBody: body,
 	})
 }
 
 type MiddlewareFunc func(next http.Handler) http.Handler
 
-func VerifyJWT(next http.Handler) http.Handler {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	var role string
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		encoder := json.NewEncoder(w)
-		if r.Header["Token"] != nil {
-			token, err := jwt.Parse(r.Header.Get("Token"), func(token *jwt.Token) (interface{}, error) {
-				return []byte(os.Getenv("JWT_SECRET_KEY")), nil
-			})
-			if err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
-				logger.Debug("Request discarded: auth failed")
-				returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
-				return
-			}
-			if token.Valid {
-				claims, ok := token.Claims.(jwt.MapClaims)
-				if ok {
-					role = claims["role"].(string)
-					r = r.WithContext(context.WithValue(context.Background(), "role", role))
-					logger.Debug(fmt.Sprintf("User with claims %s authenticated", role))
-					next.ServeHTTP(w, r)
-				} else {
-					logger.Debug("Request discarded: auth failed: required claim absent")
-					w.WriteHeader(http.StatusUnauthorized)
-					returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
-					return
-				}
-			} else {
-				w.WriteHeader(http.StatusUnauthorized)
-				logger.Debug("Request discarded: auth failed: invalid token")
-				returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
-				return
-			}
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			logger.Debug("Request discarded: auth failed: token absent")
-			returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
-			return
-		}
+// Revocations reports whether an access token was revoked.
+type Revocations interface {
+	IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error)
+}
+
+// VerifyJWT authenticates requests by the access token in the Authorization
+// header, rejecting tokens found in revocations. A nil revocations checks none.
+func VerifyJWT(revocations Revocations) MiddlewareFunc {
+	return Authenticate(JWTAuthenticator(revocations))
+}
+
+// claimTime returns the time of a numeric date claim verified by auth.ParseJWT.
+func claimTime(claims map[string]any, name string) time.Time {
+	seconds, _ := claims[name].(float64)
+	return time.Unix(int64(seconds), 0)
+}
+
+// ClientIP returns the address of the client of r. Forwarding headers are
+// ignored, as any client can set them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	return http.HandlerFunc(fn)
+	return host
 }
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/Paincake/filmbase/internal/ratelimit"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type revokedTokens map[string]bool
+
+func (r revokedTokens) IsTokenRevoked(jti string, username string, issuedAt time.Time) (bool, error) {
+	return r[jti], nil
+}
+
+func TestVerifyJWT_ShouldRejectRevokedToken(t *testing.T) {
+	auth.SetSecretKey("secret")
+	token, _ := auth.CreateJWT("test", "admin")
+	claims, _ := auth.ParseJWT(token)
+	handler := VerifyJWT(revokedTokens{claims["jti"].(string): true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", token)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	other, _ := auth.CreateJWT("test", "admin")
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", other)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestVerifyJWT_ShouldRejectTokenWithoutId(t *testing.T) {
+	auth.SetSecretKey("secret")
+	now := time.Now()
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": "test", "iss": "filmbase", "aud": "filmbase", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+	}).SignedString(auth.SecretKey())
+	handler := VerifyJWT(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", token)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestVerifyJWT_ShouldReadBearerTokenAndChallenge(t *testing.T) {
+	auth.SetSecretKey("secret")
+	token, _ := auth.CreateJWT("test", "admin")
+	handler := VerifyJWT(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("Authorization", "bearer "+token)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Deprecation"))
+
+	recorder = serve("Token", token)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+
+	recorder = serve("", "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, `Bearer realm="filmbase"`, recorder.Header().Get("WWW-Authenticate"))
+
+	recorder = serve("Authorization", "Bearer "+token+"x")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, `Bearer realm="filmbase", error="invalid_token"`, recorder.Header().Get("WWW-Authenticate"))
+
+	recorder = serve("Authorization", "Bearer ")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, `Bearer realm="filmbase", error="invalid_request"`, recorder.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuthorize_ShouldChallengeInsufficientScope(t *testing.T) {
+	auth.SetSecretKey("secret")
+	token, _ := auth.CreateJWT("test", "user")
+	p := policy.Parse(map[string]string{"user": "read"})
+	handler := VerifyJWT(nil)(Authorize(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/film", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(recorder, req.WithContext(withScopes(req, []string{policy.ScopeWrite})))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, `Bearer realm="filmbase", error="insufficient_scope", scope="write"`, recorder.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuthorize_ShouldRejectOperationWithoutScopes(t *testing.T) {
+	auth.SetSecretKey("secret")
+	token, _ := auth.CreateJWT("test", "admin")
+	p := policy.Parse(map[string]string{"admin": "read write admin"})
+	handler := VerifyJWT(nil)(Authorize(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	serve := func(ctx func(*http.Request) *http.Request) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(recorder, ctx(req))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(func(r *http.Request) *http.Request { return r }))
+	assert.Equal(t, http.StatusOK, serve(func(r *http.Request) *http.Request { return r.WithContext(withScopes(r, []string{})) }))
+}
+
+func TestRateLimit_ShouldLimitUsersAndAnonymousClientsApart(t *testing.T) {
+	auth.SetSecretKey("secret")
+	limiter := ratelimit.New(ratelimit.NewMemory(), ratelimit.Options{Default: ratelimit.Limit{Rate: 0.1, Burst: 1}})
+	handler := RequestLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)), "/film")(
+		VerifyJWT(nil)(RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	token, _ := auth.CreateJWT("test", "admin")
+	serve := func(token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		if token != "" {
+			req.Header.Set("Token", token)
+		}
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve(token)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", recorder.Header().Get("RateLimit-Reset"))
+	recorder = serve(token)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "10", recorder.Header().Get("Retry-After"))
+
+	// The limit of the user does not apply to their address.
+	anonymous := RequestLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)), "/login")(
+		RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	recorder = httptest.NewRecorder()
+	anonymous.ServeHTTP(recorder, httptest.NewRequest("POST", "/login", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestRateLimit_ShouldLimitClientsFailingAuthentication(t *testing.T) {
+	auth.SetSecretKey("secret")
+	clients := ratelimit.New(ratelimit.NewMemory(), ratelimit.Options{Default: ratelimit.Limit{Rate: 0.1, Burst: 1}})
+	handler := RequestLogger(slog.New(slog.NewJSONHandler(io.Discard, nil)), "/film")(
+		RateLimit(clients)(VerifyJWT(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		req.Header.Set("Token", "invalid")
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve().Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve().Code)
+}
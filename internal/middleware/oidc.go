@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// provisionInterval is how often the role of a user authenticated by an OIDC
+// provider is written at most. Whether the user is disabled is checked on
+// every request with the revocations.
+const provisionInterval = time.Minute
+
+// Users provisions the users of external identity providers.
+type Users interface {
+	ProvisionUser(username string, provider string, role string) (database.User, error)
+}
+
+// OIDCAuthenticator authenticates requests by a token of provider in the
+// Authorization header. The user and the role are taken from its claims by mapping and the
+// user is provisioned just in time into users under the issuer of provider.
+// Like local tokens, they are rejected when found in revocations.
+func OIDCAuthenticator(provider *auth.OIDCProvider, mapping auth.ClaimMapping, users Users, revocations Revocations) Authenticator {
+	var mu sync.Mutex
+	provisioned := make(map[[2]string]time.Time)
+	pruned := time.Now()
+	return AuthenticatorFunc(func(r *http.Request) (Identity, error) {
+		token, err := bearerToken(r)
+		if err != nil {
+			return Identity{}, err
+		}
+		if !provider.Issued(token) {
+			return Identity{}, ErrNoCredentials
+		}
+		claims, err := provider.Verify(r.Context(), token)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+		}
+		username, role, err := mapping.Map(claims)
+		if err != nil {
+			return Identity{}, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+		}
+
+		key := [2]string{username, role}
+		mu.Lock()
+		at, ok := provisioned[key]
+		mu.Unlock()
+		if !ok || time.Since(at) >= provisionInterval {
+			user, err := users.ProvisionUser(username, provider.Issuer, role)
+			if errors.Is(err, database.ErrUserConflict) {
+				return Identity{}, fmt.Errorf("%w: user %s: %s", ErrInvalidCredentials, username, err)
+			}
+			if err != nil {
+				return Identity{}, fmt.Errorf("provisioning user %s: %w", username, err)
+			}
+			if user.Disabled {
+				return Identity{}, fmt.Errorf("%w: user %s disabled", ErrInvalidCredentials, username)
+			}
+			mu.Lock()
+			now := time.Now()
+			provisioned[key] = now
+			// Users who are provisioned again after the interval anyway are
+			// dropped, so that the map holds the recently seen users only.
+			if now.Sub(pruned) >= provisionInterval {
+				for k, at := range provisioned {
+					if now.Sub(at) >= provisionInterval {
+						delete(provisioned, k)
+					}
+				}
+				pruned = now
+			}
+			mu.Unlock()
+		}
+
+		identity := Identity{
+			Username:  username,
+			Role:      role,
+			Method:    "oidc",
+			TokenID:   claimString(claims, "jti"),
+			ExpiresAt: claimTime(claims, "exp"),
+		}
+		return identity, checkRevoked(revocations, identity, claimTime(claims, "iat"))
+	})
+}
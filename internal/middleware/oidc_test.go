@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockIssuer is an OpenID Connect provider publishing the key it signs with.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	issuer := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/jwks"})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(dto.JWKS{Keys: []dto.JWK{{
+			KeyType:   "RSA",
+			KeyID:     "mock",
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *mockIssuer) token(t *testing.T, claims jwt.MapClaims) string {
+	now := time.Now()
+	all := jwt.MapClaims{"iss": i.URL, "aud": "filmbase", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+	for name, value := range claims {
+		all[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = "mock"
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return signed
+}
+
+type provisionedUsers map[string]database.User
+
+func (u provisionedUsers) ProvisionUser(username string, provider string, role string) (database.User, error) {
+	user, ok := u[username]
+	if ok && user.Provider != provider {
+		return database.User{}, database.ErrUserConflict
+	}
+	user = database.User{Username: username, Role: role, Provider: provider, Disabled: user.Disabled}
+	u[username] = user
+	return user, nil
+}
+
+func TestOIDCAuthenticator_ShouldProvisionMappedUser(t *testing.T) {
+	issuer := newMockIssuer(t)
+	users := provisionedUsers{"local": {Username: "local", Provider: database.LocalProvider}}
+	mapping := auth.ClaimMapping{UsernameClaim: "preferred_username", RoleClaim: "groups", Roles: map[string]string{"filmbase-admins": "admin", "filmbase-users": "user"},
+		Precedence: []string{"admin", "user"}, DefaultRole: "user"}
+	var role any
+	handler := Authenticate(JWTAuthenticator(nil), OIDCAuthenticator(auth.NewOIDCProvider(issuer.URL, "filmbase"), mapping, users, nil))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role = r.Context().Value("role")
+		}))
+	serve := func(token string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/film", nil)
+		req.Header.Set("Token", token)
+		handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(issuer.token(t, jwt.MapClaims{"preferred_username": "alice", "groups": []string{"staff", "filmbase-admins"}})))
+	assert.Equal(t, "admin", role)
+	assert.Equal(t, database.User{Username: "alice", Role: "admin", Provider: issuer.URL}, users["alice"])
+
+	assert.Equal(t, http.StatusOK, serve(issuer.token(t, jwt.MapClaims{"preferred_username": "bob"})))
+	assert.Equal(t, "user", role)
+
+	// The role with precedence wins whatever the order of the groups.
+	for _, groups := range [][]string{{"filmbase-users", "filmbase-admins"}, {"filmbase-admins", "filmbase-users"}} {
+		assert.Equal(t, http.StatusOK, serve(issuer.token(t, jwt.MapClaims{"preferred_username": "carol", "groups": groups})))
+		assert.Equal(t, "admin", role, groups)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(issuer.token(t, jwt.MapClaims{"preferred_username": "local"})))
+	assert.Equal(t, http.StatusUnauthorized, serve(issuer.token(t, jwt.MapClaims{"preferred_username": "alice", "aud": "other"})))
+	assert.Equal(t, http.StatusUnauthorized, serve(issuer.token(t, jwt.MapClaims{"groups": "filmbase-admins"})))
+}
+
+func TestOIDCAuthenticator_ShouldRejectTokenSignedWithOtherKey(t *testing.T) {
+	issuer := newMockIssuer(t)
+	other := newMockIssuer(t)
+	other.URL = issuer.URL
+	mapping := auth.ClaimMapping{UsernameClaim: "preferred_username"}
+	handler := Authenticate(OIDCAuthenticator(auth.NewOIDCProvider(issuer.URL, "filmbase"), mapping, provisionedUsers{}, nil))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("Token", other.token(t, jwt.MapClaims{"preferred_username": "alice"}))
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RateLimit rejects the requests of clients that ran out of tokens, see
+// ratelimit.Limiter. Authenticated requests are counted per user, others per
+// client address. Run after Authenticate it limits users, run before it limits
+// the addresses requests fail authentication from. Every response carries
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+func RateLimit(limiter *ratelimit.Limiter) MiddlewareFunc {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, role := ratelimit.ClientKey(ClientIP(r)), ""
+			if username, _ := r.Context().Value("username").(string); username != "" {
+				key = ratelimit.UserKey(username)
+				role, _ = r.Context().Value("role").(string)
+			}
+			decision, err := limiter.Take(Route(r.Context()), key, role)
+			if err != nil {
+				// Requests are served rather than rejected while the store is unavailable.
+				Logger(r.Context(), logger).Error(fmt.Sprintf("Rate limiting %s: %s", key, err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(decision.Reset))
+			if !decision.Allowed {
+				Logger(r.Context(), logger).Info(fmt.Sprintf("Request discarded: rate limit of %s exceeded", key))
+				w.Header().Set("Retry-After", ceilSeconds(decision.RetryAfter))
+				returnResponse(w, *json.NewEncoder(w), http.StatusTooManyRequests, nil, fmt.Errorf("too many requests"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds formats d in whole seconds, rounded up so that clients do not
+// retry too early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import "net/http"
+
+// ResponseRecorder remembers the status code written through it.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rec *ResponseRecorder) WriteHeader(code int) {
+	rec.Status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"slices"
+	"strings"
+)
+
+// ScopesContextKey is the context key of the scopes an operation requires.
+const ScopesContextKey = "filmbase_auth.Scopes"
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	// ScopeAdmin grants user and token management.
+	ScopeAdmin = "admin"
+)
+
+// Policy maps roles to the scopes they are granted.
+type Policy struct {
+	scopes map[string][]string
+}
+
+// New returns the policy granting every role the scopes in roles.
+func New(roles map[string][]string) *Policy {
+	scopes := make(map[string][]string, len(roles))
+	for role, s := range roles {
+		scopes[role] = slices.Clone(s)
+	}
+	return &Policy{scopes: scopes}
+}
+
+// Parse returns the policy of roles given as space separated scopes, e.g.
+// {"admin": "read write admin", "user": "read"}.
+func Parse(roles map[string]string) *Policy {
+	parsed := make(map[string][]string, len(roles))
+	for role, s := range roles {
+		parsed[role] = strings.Fields(s)
+	}
+	return New(parsed)
+}
+
+// Scopes returns the scopes granted to role.
+func (p *Policy) Scopes(role string) []string {
+	return slices.Clone(p.scopes[role])
+}
+
+// Allows reports whether role is granted every scope in required.
+func (p *Policy) Allows(role string, required []string) bool {
+	granted := p.scopes[role]
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package policy_test
+
+import (
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/handler"
+	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+var defaultRoles = map[string]string{"admin": "read write admin", "user": "read"}
+
+func TestParse_ShouldGrantScopes(t *testing.T) {
+	p := policy.Parse(defaultRoles)
+	assert.True(t, p.Allows("admin", []string{policy.ScopeRead, policy.ScopeWrite}))
+	assert.True(t, p.Allows("user", []string{policy.ScopeRead}))
+	assert.False(t, p.Allows("user", []string{policy.ScopeWrite}))
+	assert.False(t, p.Allows("", []string{policy.ScopeRead}))
+	assert.True(t, p.Allows("", nil))
+	assert.Equal(t, []string{"read"}, p.Scopes("user"))
+}
+
+// TestOperations_ShouldEnforceScopes is the authorization matrix of every
+// authenticated operation: the roles allowed to call it under the default policy.
+func TestOperations_ShouldEnforceScopes(t *testing.T) {
+	auth.SetSecretKey("secret")
+	// reached stands in for the handler, so that only the authorization runs.
+	reached := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+	wrapper := handler.ServerInterfaceWrapper{
+		Logger:             slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		HandlerMiddlewares: []middleware.MiddlewareFunc{reached, middleware.Authorize(policy.Parse(defaultRoles)), middleware.VerifyJWT(nil)},
+		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			t.Errorf("%s %s: %s", r.Method, r.URL, err)
+		},
+	}
+
+	admin := []string{"admin"}
+	everyone := []string{"admin", "user", "guest"}
+	readers := []string{"admin", "user"}
+	operations := []struct {
+		name    string
+		target  string
+		handler http.HandlerFunc
+		allowed []string
+	}{
+		{"CreateActor", "/actor", wrapper.CreateActor, admin},
+		{"PutActor", "/actor", wrapper.PutActor, admin},
+		{"GetActorFilms", "/actor/films", wrapper.GetActorFilms, readers},
+		{"DeleteActor", "/actor/1?actorId=1", wrapper.DeleteActor, admin},
+		{"PostActorFilm", "/actor/1/1?actorId=1&filmId=1", wrapper.PostActorFilm, admin},
+		{"GetFilm", "/film", wrapper.GetFilm, readers},
+		{"CreateFilm", "/film", wrapper.CreateFilm, admin},
+		{"ChangeFilm", "/film", wrapper.ChangeFilm, admin},
+		{"GetFilmSearch", "/film/search?filmName=a&actorName=a", wrapper.GetFilmSearch, readers},
+		{"DeleteFilm", "/film/1?filmId=1", wrapper.DeleteFilm, admin},
+		{"Logout", "/logout", wrapper.Logout, everyone},
+		{"RevokeUserTokens", "/admin/users/test/revoke", wrapper.RevokeUserTokens, admin},
+		{"ListUsers", "/admin/users", wrapper.ListUsers, admin},
+		{"SetUserRole", "/admin/users/test/role", wrapper.SetUserRole, admin},
+		{"DisableUser", "/admin/users/test/disable", wrapper.DisableUser, admin},
+		{"EnableUser", "/admin/users/test/enable", wrapper.EnableUser, admin},
+		{"UnlockUser", "/admin/users/test/unlock", wrapper.UnlockUser, admin},
+		{"DeleteUser", "/admin/users/test", wrapper.DeleteUser, admin},
+		{"CreateAPIKey", "/admin/api-keys", wrapper.CreateAPIKey, admin},
+		{"ListAPIKeys", "/admin/api-keys", wrapper.ListAPIKeys, admin},
+		{"DeleteAPIKey", "/admin/api-keys/test", wrapper.DeleteAPIKey, admin},
+	}
+	for _, op := range operations {
+		for _, role := range everyone {
+			token, _ := auth.CreateJWT("test", role)
+			req := httptest.NewRequest("POST", op.target, nil)
+			req.SetPathValue("username", "test")
+			req.SetPathValue("prefix", "test")
+			req.Header.Set("Token", token)
+			recorder := httptest.NewRecorder()
+			op.handler(recorder, req)
+
+			want := http.StatusForbidden
+			for _, allowed := range op.allowed {
+				if allowed == role {
+					want = http.StatusOK
+				}
+			}
+			assert.Equal(t, want, recorder.Code, "%s as %s", op.name, role)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package problem renders errors as problem details (RFC 7807), so that
+// clients get a machine readable type and a message for every error.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Paincake/filmbase/internal/database"
+	"net/http"
+)
+
+const ContentType = "application/problem+json"
+
+// Types of the problems clients are expected to handle. Other problems are
+// of type about:blank, their status says it all.
+const (
+	TypeNotFound   = "urn:filmbase:problem:not-found"
+	TypeConflict   = "urn:filmbase:problem:conflict"
+	TypeValidation = "urn:filmbase:problem:validation"
+	TypeForbidden  = "urn:filmbase:problem:forbidden"
+)
+
+var types = map[int]string{
+	http.StatusNotFound:            TypeNotFound,
+	http.StatusConflict:            TypeConflict,
+	http.StatusUnprocessableEntity: TypeValidation,
+	http.StatusForbidden:           TypeForbidden,
+}
+
+// Details are the problem details of an error.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Errors are the fields at fault, if any.
+	Errors []database.FieldError `json:"errors,omitempty"`
+}
+
+// fieldErrors is implemented by errors that concern fields of the request.
+type fieldErrors interface {
+	FieldErrors() []database.FieldError
+}
+
+// Status returns the status of the domain error err, 500 for other errors.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, database.ErrForbidden):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// New returns the details of err answered with status. Server errors carry no
+// detail, their cause is logged rather than shown to clients.
+func New(status int, err error) Details {
+	d := Details{Type: "about:blank", Title: http.StatusText(status), Status: status}
+	if t, ok := types[status]; ok {
+		d.Type = t
+	}
+	if status >= http.StatusInternalServerError || err == nil {
+		return d
+	}
+	d.Detail = err.Error()
+	var fields fieldErrors
+	if errors.As(err, &fields) {
+		d.Errors = fields.FieldErrors()
+	}
+	return d
+}
+
+// Write answers with err as problem details.
+func Write(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(New(status, err))
+}
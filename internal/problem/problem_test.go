@@ -0,0 +1,39 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNew_ShouldDescribeDomainErrors(t *testing.T) {
+	err := fmt.Errorf("deleting actor: %w", database.NotFound("actor %d not found", 1))
+	assert.Equal(t, http.StatusNotFound, Status(err))
+	assert.Equal(t, Details{Type: TypeNotFound, Title: "Not Found", Status: 404, Detail: "deleting actor: actor 1 not found"}, New(Status(err), err))
+
+	err = database.Invalid(database.FieldError{Field: "rating", Message: "is out of range"})
+	assert.Equal(t, http.StatusUnprocessableEntity, Status(err))
+	assert.Equal(t, []database.FieldError{{Field: "rating", Message: "is out of range"}}, New(Status(err), err).Errors)
+}
+
+func TestNew_ShouldHideServerErrors(t *testing.T) {
+	err := errors.New("connection refused")
+	assert.Equal(t, http.StatusInternalServerError, Status(err))
+	assert.Equal(t, Details{Type: "about:blank", Title: "Internal Server Error", Status: 500}, New(Status(err), err))
+}
+
+func TestWrite_ShouldListInvalidFields(t *testing.T) {
+	err := database.Invalid(
+		database.FieldError{Field: "gender", Message: "must be one of male, female"},
+		database.FieldError{Field: "name", Message: "is required"},
+	)
+	recorder := httptest.NewRecorder()
+	Write(recorder, http.StatusUnprocessableEntity, fmt.Errorf("bad request: %w", err))
+	assert.Equal(t, ContentType, recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), `"type":"urn:filmbase:problem:validation"`)
+	assert.Contains(t, recorder.Body.String(), `"errors":[{"field":"gender","message":"must be one of male, female"},{"field":"name","message":"is required"}]`)
+}
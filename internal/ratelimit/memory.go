@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping buckets in the process. Buckets are lost on
+// restart and not shared between instances, so every instance allows the
+// full rate.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// pruneAt is the number of keys at which full buckets are pruned.
+	pruneAt int
+}
+
+// minPruneAt is the number of keys below which buckets are never pruned.
+const minPruneAt = 1024
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), pruneAt: minPruneAt}
+}
+
+func (m *Memory) Take(key string, limit Limit, now time.Time) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= m.pruneAt {
+			m.prune(now)
+			m.pruneAt = max(minPruneAt, 2*len(m.buckets))
+		}
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		m.buckets[key] = b
+	}
+	return b.take(limit, now), nil
+}
+
+func (m *Memory) Prune(now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prune(now), nil
+}
+
+// prune deletes the buckets full by now. Besides on Prune it runs whenever the
+// keys doubled, so that a flood of clients costs amortised constant time.
+func (m *Memory) prune(now time.Time) int64 {
+	var pruned int64
+	for key, b := range m.buckets {
+		if !b.full.After(now) {
+			delete(m.buckets, key)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,122 @@
+// Package ratelimit limits the rate of requests with token buckets. Every
+// client has a bucket of Burst tokens refilled at Rate tokens per second, and
+// every request takes a token. Clients are users, or addresses on anonymous
+// routes.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit is the size of a bucket and how fast it refills.
+type Limit struct {
+	// Rate is the number of requests per second a client may sustain.
+	Rate float64
+	// Burst is the number of requests a client may send at once.
+	Burst int
+}
+
+// Decision is whether a request may be served, and the state of its bucket.
+type Decision struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests that may be sent at once now.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a request is allowed, zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets per key. Memory keeps them in the process, a store
+// shared by every instance has to take tokens atomically.
+type Store interface {
+	// Take takes a token from the bucket of key, created full with limit.
+	Take(key string, limit Limit, now time.Time) (Decision, error)
+	// Prune deletes the buckets that are full by now, they are recreated as
+	// they were.
+	Prune(now time.Time) (int64, error)
+}
+
+// Options are the limits of clients.
+type Options struct {
+	// Default is the limit of anonymous clients and of users whose role has no
+	// limit of its own.
+	Default Limit
+	// Roles are the limits of the users of a role.
+	Roles map[string]Limit
+	// Routes are the limits on routes such as "POST /login". Clients have a
+	// bucket of their own on each of them, requests to them do not take
+	// tokens from the bucket the other routes share.
+	Routes map[string]Limit
+}
+
+// Limiter decides whether a request may be served.
+type Limiter struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+func New(store Store, opts Options) *Limiter {
+	return &Limiter{store: store, opts: opts, now: time.Now}
+}
+
+// UserKey and ClientKey are the keys of the buckets of a user and of an
+// anonymous client.
+func UserKey(username string) string {
+	return "user:" + username
+}
+
+func ClientKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+// Take takes a token for a request to route by the client key, a user of role
+// or an anonymous client when role is empty.
+func (l *Limiter) Take(route, key, role string) (Decision, error) {
+	limit, ok := l.opts.Routes[route]
+	if ok {
+		key = route + " " + key
+	} else if limit, ok = l.opts.Roles[role]; !ok {
+		limit = l.opts.Default
+	}
+	return l.store.Take(key, limit, l.now())
+}
+
+// Prune deletes the buckets that are full anyway.
+func (l *Limiter) Prune() (int64, error) {
+	return l.store.Prune(l.now())
+}
+
+// bucket is the state of a bucket as of at.
+type bucket struct {
+	tokens float64
+	at     time.Time
+	// full is when the bucket is full again.
+	full time.Time
+}
+
+// take refills b until now and takes a token from it if there is one.
+func (b *bucket) take(limit Limit, now time.Time) Decision {
+	if now.After(b.at) {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.at).Seconds()*limit.Rate)
+		b.at = now
+	}
+	d := Decision{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.Rate)
+	b.full = now.Add(d.Reset)
+	return d
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newLimiter(now *time.Time) *Limiter {
+	l := New(NewMemory(), Options{
+		Default: Limit{Rate: 1, Burst: 2},
+		Roles:   map[string]Limit{"admin": {Rate: 10, Burst: 5}},
+		Routes:  map[string]Limit{"POST /login": {Rate: 0.5, Burst: 1}},
+	})
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func take(t *testing.T, l *Limiter, route, key, role string) Decision {
+	decision, err := l.Take(route, key, role)
+	if err != nil {
+		t.Fatalf("test failed: %s", err)
+	}
+	return decision
+}
+
+func TestLimiter_ShouldRefillBuckets(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(&now)
+	assert.Equal(t, Decision{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, take(t, l, "GET /film", "ip:192.0.2.1", ""))
+	assert.True(t, take(t, l, "PUT /film", "ip:192.0.2.1", "").Allowed)
+	decision := take(t, l, "GET /film", "ip:192.0.2.1", "")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+	assert.Equal(t, 2*time.Second, decision.Reset)
+	assert.True(t, take(t, l, "GET /film", "ip:192.0.2.2", "").Allowed)
+
+	now = now.Add(time.Second)
+	assert.True(t, take(t, l, "GET /film", "ip:192.0.2.1", "").Allowed)
+	assert.False(t, take(t, l, "GET /film", "ip:192.0.2.1", "").Allowed)
+}
+
+func TestLimiter_ShouldApplyRoleAndRouteLimits(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(&now)
+	for range 5 {
+		assert.True(t, take(t, l, "GET /film", "user:root", "admin").Allowed)
+	}
+	assert.False(t, take(t, l, "GET /film", "user:root", "admin").Allowed)
+
+	// A route with a limit of its own has a bucket of its own.
+	assert.True(t, take(t, l, "POST /login", "user:root", "admin").Allowed)
+	decision := take(t, l, "POST /login", "user:root", "admin")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 2*time.Second, decision.RetryAfter)
+}
+
+func TestMemory_ShouldPruneFullBuckets(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(&now)
+	take(t, l, "GET /film", "ip:192.0.2.1", "")
+	take(t, l, "GET /film", "ip:192.0.2.2", "")
+	take(t, l, "GET /film", "ip:192.0.2.2", "")
+
+	now = now.Add(time.Second)
+	pruned, err := l.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), pruned)
+	assert.Equal(t, 0, take(t, l, "GET /film", "ip:192.0.2.2", "").Remaining)
+}
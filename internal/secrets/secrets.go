@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider looks secrets up by the name of the environment variable they would
+// otherwise be given in, e.g. JWT_SECRET_KEY.
+type Provider interface {
+	Lookup(name string) (string, bool, error)
+}
+
+// Env provides secrets from plain environment variables.
+type Env struct{}
+
+func (Env) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// EnvFile provides the content of the file named by the NAME_FILE environment
+// variable, the way Docker and Kubernetes secrets are mounted.
+type EnvFile struct{}
+
+func (EnvFile) Lookup(name string) (string, bool, error) {
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("reading %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// Chain asks every provider in turn and returns the first secret found.
+type Chain []Provider
+
+func (c Chain) Lookup(name string) (string, bool, error) {
+	for _, p := range c {
+		value, ok, err := p.Lookup(name)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return "", false, nil
+}
+
+// Store keeps the secrets loaded at startup and refreshes them from its
+// provider on demand, so that rotated secrets are used without a restart.
+type Store struct {
+	provider Provider
+
+	mu       sync.RWMutex
+	values   map[string]string
+	onChange []func()
+}
+
+// NewStore returns a store of the secrets in initial, which are kept when the
+// provider does not know them.
+func NewStore(provider Provider, initial map[string]string) *Store {
+	values := make(map[string]string, len(initial))
+	for name, value := range initial {
+		values[name] = value
+	}
+	return &Store{provider: provider, values: values}
+}
+
+func (s *Store) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[name]
+}
+
+// OnChange registers fn to be called after a refresh changed a secret.
+func (s *Store) OnChange(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = append(s.onChange, fn)
+}
+
+// Refresh looks every secret up again. Secrets that fail to load keep their
+// previous value.
+func (s *Store) Refresh() error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+
+	var errs []string
+	changed := false
+	for _, name := range names {
+		value, ok, err := s.provider.Lookup(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		if s.values[name] != value {
+			s.values[name] = value
+			changed = true
+		}
+		s.mu.Unlock()
+	}
+
+	if changed {
+		s.mu.RLock()
+		callbacks := append([]func(){}, s.onChange...)
+		s.mu.RUnlock()
+		for _, fn := range callbacks {
+			fn()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("refreshing secrets: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Watch refreshes the secrets every interval and whenever reload receives,
+// until ctx is done. A non-positive interval disables periodic refreshes.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal, onError func(error)) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-reload:
+		}
+		if err := s.Refresh(); err != nil {
+			onError(err)
+		}
+	}
+}
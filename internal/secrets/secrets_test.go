@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvFile_ShouldReadFileNamedByVariable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET_KEY_FILE", path)
+
+	value, ok, err := EnvFile{}.Lookup("JWT_SECRET_KEY")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "from-file", value)
+}
+
+func TestEncrypted_ShouldReadWhatWasWritten(t *testing.T) {
+	encodedKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(encodedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err = WriteEncrypted(path, key, map[string]string{"DB_PASSWORD": "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	value, ok, err := Encrypted{Path: path, Key: key}.Lookup("DB_PASSWORD")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hunter2", value)
+
+	otherKey, _ := GenerateKey()
+	wrongKey, _ := ParseKey(otherKey)
+	_, _, err = Encrypted{Path: path, Key: wrongKey}.Lookup("DB_PASSWORD")
+	assert.Error(t, err)
+}
+
+func TestSeal_ShouldOpenOnlyWithItsKey(t *testing.T) {
+	encodedKey, _ := GenerateKey()
+	key, _ := ParseKey(encodedKey)
+	sealed, err := Seal(key, []byte("private key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, string(sealed), "private key")
+
+	plaintext, err := Open(key, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "private key", string(plaintext))
+
+	otherKey, _ := GenerateKey()
+	wrongKey, _ := ParseKey(otherKey)
+	_, err = Open(wrongKey, sealed)
+	assert.Error(t, err)
+}
+
+func TestStore_ShouldRefreshAndNotifyOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JWT_SECRET_KEY_FILE", path)
+	store := NewStore(EnvFile{}, map[string]string{"JWT_SECRET_KEY": "old"})
+	changes := 0
+	store.OnChange(func() { changes++ })
+
+	assert.NoError(t, store.Refresh())
+	assert.Equal(t, 0, changes)
+	if err := os.WriteFile(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.Refresh())
+	assert.Equal(t, 1, changes)
+	assert.Equal(t, "new", store.Get("JWT_SECRET_KEY"))
+
+	// A secret that fails to load keeps its previous value.
+	assert.NoError(t, os.Remove(path))
+	assert.Error(t, store.Refresh())
+	assert.Equal(t, "new", store.Get("JWT_SECRET_KEY"))
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"log/slog"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AccountMail makes the mail sent to reset passwords and to verify emails.
+// ResetURL and VerifyURL are the pages the mailed links lead to, the token is
+// added to them as the token query parameter.
+type AccountMail struct {
+	ResetURL  string
+	VerifyURL string
+	ResetTTL  time.Duration
+	VerifyTTL time.Duration
+}
+
+const passwordResetMail = `Hello %s,
+
+someone asked to reset the password of your filmbase account. To choose a new
+password, follow this link within %s:
+
+%s
+
+If it was not you, ignore this mail and your password stays unchanged.
+`
+
+const emailVerificationMail = `Hello %s,
+
+to verify that this is your email address, follow this link within %s:
+
+%s
+`
+
+func (a AccountMail) mailPasswordReset(repository database.FilmbaseRepository, username, email string) error {
+	return mailToken(repository, username, email, database.PurposePasswordReset, a.ResetTTL, a.ResetURL,
+		"Reset your filmbase password", passwordResetMail)
+}
+
+func (a AccountMail) mailVerification(repository database.FilmbaseRepository, username, email string) error {
+	return mailToken(repository, username, email, database.PurposeEmailVerification, a.VerifyTTL, a.VerifyURL,
+		"Verify your filmbase email", emailVerificationMail)
+}
+
+// mailToken stores a new token of purpose for username and queues the mail
+// carrying it to email, rendering body with the username, ttl and the link.
+func mailToken(repository database.FilmbaseRepository, username, email, purpose string, ttl time.Duration, page, subject, body string) error {
+	token, hash, err := auth.NewOneTimeToken()
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(page)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return repository.CreateUserToken(
+		database.UserToken{Hash: hash, Username: username, Purpose: purpose, Email: email, ExpiresAt: time.Now().Add(ttl)},
+		database.Mail{Recipient: email, Subject: subject, Body: fmt.Sprintf(body, username, within(ttl), link)})
+}
+
+// within renders d for mail, e.g. 2 hours or 30 minutes.
+func within(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d > time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d == time.Minute:
+		return "1 minute"
+	default:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+}
+
+// normalizeEmail returns the bare address of email in lower case, as emails
+// are unique regardless of case.
+func normalizeEmail(email string) (string, error) {
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != strings.TrimSpace(email) {
+		return "", fmt.Errorf("invalid email %q", email)
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// ForgotPassword Mail a password reset link to the user with an email
+// (POST /password/forgot)
+func (s BasicServer) ForgotPassword(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.ForgotPassword POST /password/forgot"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if s.AccountMail == nil {
+		log.Info("Request discarded: mail disabled")
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	user, ok := userByEmail(w, r, repository, *encoder, log)
+	if !ok {
+		return
+	}
+	// The response is the same whether the email belongs to a user or not.
+	if user.Username == "" {
+		log.Info("No password reset mailed: unknown email")
+		returnResponse(w, *encoder, http.StatusAccepted, nil, nil)
+		return
+	}
+	if err := s.AccountMail.mailPasswordReset(repository, user.Username, user.Email); err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Password reset of %s mailed", user.Username))
+	returnResponse(w, *encoder, http.StatusAccepted, nil, nil)
+}
+
+// ResetPassword Set a new password with a mailed reset token
+// (POST /password/reset)
+func (s BasicServer) ResetPassword(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.ResetPassword POST /password/reset"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if s.AccountMail == nil {
+		log.Info("Request discarded: mail disabled")
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	var request dto.PasswordReset
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	hash := auth.HashToken(request.Token)
+	// The token is only spent once the new password is accepted.
+	token, err := repository.UserToken(hash, database.PurposePasswordReset)
+	if errors.Is(err, database.ErrUserTokenInvalid) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	if s.Passwords != nil {
+		if problems := s.Passwords.Check(token.Username, request.Password); len(problems) > 0 {
+			log.Info(fmt.Sprintf("Request discarded: weak password: %s", strings.Join(problems, ", ")))
+			returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: password %s", strings.Join(problems, ", ")))
+			return
+		}
+	}
+	password, err := auth.HashPassword(request.Password)
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	user, err := repository.ResetPassword(hash, password)
+	if errors.Is(err, database.ErrUserTokenInvalid) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	// Whoever knew the old password must not stay logged in, nor should the
+	// user stay locked out.
+	if err = repository.RevokeUserTokens(user.Username); err != nil {
+		log.Error(fmt.Sprintf("Revoking tokens of %s: %s", user.Username, err))
+	}
+	if s.Lockout != nil {
+		if err = s.Lockout.Unlock(user.Username); err != nil {
+			log.Error(fmt.Sprintf("Resetting failed logins of %s: %s", user.Username, err))
+		}
+	}
+	log.Info(fmt.Sprintf("Password of %s reset", user.Username))
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+// RequestEmailVerification Mail a verification link to an unverified email
+// (POST /email/verify/request)
+func (s BasicServer) RequestEmailVerification(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.RequestEmailVerification POST /email/verify/request"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if s.AccountMail == nil {
+		log.Info("Request discarded: mail disabled")
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	user, ok := userByEmail(w, r, repository, *encoder, log)
+	if !ok {
+		return
+	}
+	// The response is the same whether the email belongs to a user or not.
+	if user.Username == "" || user.EmailVerified {
+		log.Info("No email verification mailed: unknown or verified email")
+		returnResponse(w, *encoder, http.StatusAccepted, nil, nil)
+		return
+	}
+	if err := s.AccountMail.mailVerification(repository, user.Username, user.Email); err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Email verification of %s mailed", user.Username))
+	returnResponse(w, *encoder, http.StatusAccepted, nil, nil)
+}
+
+// VerifyEmail Verify an email with a mailed token
+// (POST /email/verify)
+func (s BasicServer) VerifyEmail(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.VerifyEmail POST /email/verify"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if s.AccountMail == nil {
+		log.Info("Request discarded: mail disabled")
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	var request dto.EmailVerification
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	user, err := repository.VerifyEmail(auth.HashToken(request.Token))
+	if errors.Is(err, database.ErrUserTokenInvalid) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Email of %s verified", user.Username))
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+// userByEmail returns the user with the email of an EmailRequest, a zero user
+// when there is none. It responds itself to invalid requests and errors,
+// reporting whether the request may go on.
+func userByEmail(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, encoder json.Encoder, log *slog.Logger) (database.User, bool) {
+	var request dto.EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return database.User{}, false
+	}
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return database.User{}, false
+	}
+	user, err := repository.UserByEmail(email)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return database.User{}, true
+	}
+	if err != nil {
+		returnError(w, encoder, log, err)
+		return database.User{}, false
+	}
+	return user, true
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CreateAPIKey Create an API key for a service account
+// (POST /admin/api-keys)
+func (s BasicServer) CreateAPIKey(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.CreateAPIKey POST /admin/api-keys"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	var request dto.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if len(s.Roles) > 0 && !slices.Contains(s.Roles, request.Role) {
+		log.Info(fmt.Sprintf("Request discarded: unknown role %q", request.Role))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: unknown role %q", request.Role))
+		return
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		log.Info("Request discarded: api key expires in the past")
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: expires_at is in the past"))
+		return
+	}
+	value, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	key := database.APIKey{
+		Prefix:    prefix,
+		Hash:      hash,
+		Name:      request.Name,
+		Role:      request.Role,
+		Scopes:    strings.Join(request.Scopes, " "),
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err = repository.CreateAPIKey(key); err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("API key %s for %s created by %v", prefix, key.Name, r.Context().Value("username")))
+	returnResponse(w, *encoder, http.StatusCreated, dto.CreatedAPIKey{APIKeyInfo: apiKeyInfo(key), Key: value}, nil)
+}
+
+// ListAPIKeys List every API key
+// (GET /admin/api-keys)
+func (_ BasicServer) ListAPIKeys(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.ListAPIKeys GET /admin/api-keys"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	keys, err := repository.ListAPIKeys()
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	infos := make([]dto.APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, apiKeyInfo(key))
+	}
+	returnResponse(w, *encoder, http.StatusOK, infos, nil)
+}
+
+// DeleteAPIKey Delete an API key
+// (DELETE /admin/api-keys/{prefix})
+func (_ BasicServer) DeleteAPIKey(w http.ResponseWriter, r *http.Request, prefix string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.DeleteAPIKey DELETE /admin/api-keys/{prefix}"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	err := repository.DeleteAPIKey(prefix)
+	if errors.Is(err, database.ErrAPIKeyNotFound) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("API key %s deleted by %v", prefix, r.Context().Value("username")))
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+func apiKeyInfo(key database.APIKey) dto.APIKeyInfo {
+	return dto.APIKeyInfo{
+		Prefix:     key.Prefix,
+		Name:       key.Name,
+		Role:       key.Role,
+		Scopes:     strings.Fields(key.Scopes),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
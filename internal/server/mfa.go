@@ -0,0 +1,366 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/auth"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// mfaChallenge returns the challenge a login of user is completed with, nil
+// when user logs in with their password alone.
+func (s BasicServer) mfaChallenge(repository database.FilmbaseRepository, user database.User) (*dto.MFAChallenge, error) {
+	totp, err := repository.TOTP(user.Username)
+	if err != nil && !errors.Is(err, database.ErrMFANotEnrolled) {
+		return nil, err
+	}
+	if !totp.Confirmed && !slices.Contains(s.MFARoles, user.Role) {
+		return nil, nil
+	}
+	challenge, err := auth.CreateMFAChallenge(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.MFAChallenge{
+		ChallengeToken:     challenge,
+		ExpiresIn:          int(auth.MFAChallengeTTL.Seconds()),
+		EnrollmentRequired: !totp.Confirmed,
+	}, nil
+}
+
+// LoginMFA Complete a login with a one-time password or a recovery code
+// (POST /login/mfa)
+func (s BasicServer) LoginMFA(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.LoginMFA POST /login/mfa"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	var request dto.MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	user, totp, ok := challengedUser(w, repository, *encoder, log, request.ChallengeToken)
+	if !ok {
+		return
+	}
+	clientIP := middleware.ClientIP(r)
+	if s.loginThrottled(w, *encoder, repository, log, user.Username, clientIP) {
+		return
+	}
+	if totp.Username == "" {
+		log.Info(fmt.Sprintf("Request discarded: %s has no TOTP secret", user.Username))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %s", database.ErrMFANotEnrolled))
+		return
+	}
+	var recoveryCodes []string
+	var err error
+	if totp.Confirmed {
+		ok, err = verifySecondFactor(repository, totp, request.Code, true)
+	} else {
+		// The first code of a secret enrolled during the login confirms it.
+		recoveryCodes, ok, err = confirmTOTP(repository, totp, request.Code)
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	if !ok {
+		log.Info(fmt.Sprintf("Request discarded: login of %s failed: invalid one-time password", user.Username))
+		s.loginFailed(repository, log, user.Username, clientIP, "invalid one-time password")
+		returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return
+	}
+	s.loginSucceeded(log, user.Username, clientIP)
+	middleware.LogWith(r.Context(), "user", user.Username, "role", user.Role)
+	token, err := issueTokens(repository, user.Username, user.Role, uuid.NewString())
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	returnResponse(w, *encoder, http.StatusOK, dto.MFAToken{Token: token, RecoveryCodes: recoveryCodes}, nil)
+}
+
+// EnrollLoginTOTP Enroll a TOTP secret during a login that requires one
+// (POST /login/mfa/enroll)
+func (s BasicServer) EnrollLoginTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.EnrollLoginTOTP POST /login/mfa/enroll"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	var request dto.MFAEnrollment
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	user, _, ok := challengedUser(w, repository, *encoder, log, request.ChallengeToken)
+	if !ok {
+		return
+	}
+	beginTOTP(w, repository, *encoder, log, user.Username)
+}
+
+// BeginTOTP Enroll a TOTP secret, confirmed with its first code
+// (POST /mfa/totp)
+func (_ BasicServer) BeginTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.BeginTOTP POST /mfa/totp"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	username, ok := currentUser(w, r, *encoder, log)
+	if !ok {
+		return
+	}
+	// Only local users log in with a password, and so with a one-time password.
+	if _, err := repository.UserCredentials(username); errors.Is(err, database.ErrUserNotFound) {
+		log.Info(fmt.Sprintf("Request discarded: %s is not a local user", username))
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	} else if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	beginTOTP(w, repository, *encoder, log, username)
+}
+
+// ConfirmTOTP Confirm a TOTP secret and get recovery codes
+// (POST /mfa/totp/confirm)
+func (_ BasicServer) ConfirmTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.ConfirmTOTP POST /mfa/totp/confirm"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	code, totp, ok := currentTOTP(w, r, repository, *encoder, log)
+	if !ok {
+		return
+	}
+	if totp.Confirmed {
+		returnError(w, *encoder, log, database.ErrMFAEnrolled)
+		return
+	}
+	recoveryCodes, ok, err := confirmTOTP(repository, totp, code)
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	if !ok {
+		log.Info(fmt.Sprintf("Request discarded: %s", database.ErrOTPInvalid))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %s", database.ErrOTPInvalid))
+		return
+	}
+	log.Info(fmt.Sprintf("TOTP of %s confirmed", totp.Username))
+	returnResponse(w, *encoder, http.StatusOK, dto.RecoveryCodes{RecoveryCodes: recoveryCodes}, nil)
+}
+
+// DeleteTOTP Stop logging in with a one-time password
+// (DELETE /mfa/totp)
+func (s BasicServer) DeleteTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.DeleteTOTP DELETE /mfa/totp"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if role, _ := r.Context().Value("role").(string); slices.Contains(s.MFARoles, role) {
+		log.Info(fmt.Sprintf("Request discarded: role %s requires two-factor authentication", role))
+		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
+		return
+	}
+	code, totp, ok := currentTOTP(w, r, repository, *encoder, log)
+	if !ok {
+		return
+	}
+	// A secret that was never confirmed is deleted without a code.
+	if totp.Confirmed {
+		ok, err := verifySecondFactor(repository, totp, code, true)
+		if err != nil {
+			returnError(w, *encoder, log, err)
+			return
+		}
+		if !ok {
+			log.Info(fmt.Sprintf("Request discarded: %s", database.ErrOTPInvalid))
+			returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %s", database.ErrOTPInvalid))
+			return
+		}
+	}
+	err := repository.DeleteTOTP(totp.Username)
+	if err != nil && !errors.Is(err, database.ErrMFANotEnrolled) {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("TOTP of %s deleted", totp.Username))
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+// RegenerateRecoveryCodes Replace the recovery codes
+// (POST /mfa/recovery-codes)
+func (_ BasicServer) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.RegenerateRecoveryCodes POST /mfa/recovery-codes"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	code, totp, ok := currentTOTP(w, r, repository, *encoder, log)
+	if !ok {
+		return
+	}
+	if !totp.Confirmed {
+		log.Info(fmt.Sprintf("Request discarded: %s", database.ErrMFANotEnrolled))
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	// A recovery code does not do, whoever holds one should not get all of them.
+	ok, err := verifySecondFactor(repository, totp, code, false)
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	if !ok {
+		log.Info(fmt.Sprintf("Request discarded: %s", database.ErrOTPInvalid))
+		returnResponse(w, *encoder, http.StatusBadRequest, nil, fmt.Errorf("bad request: %s", database.ErrOTPInvalid))
+		return
+	}
+	recoveryCodes, hashes, err := auth.NewRecoveryCodes()
+	if err == nil {
+		err = repository.SetRecoveryCodes(totp.Username, hashes)
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Recovery codes of %s replaced", totp.Username))
+	returnResponse(w, *encoder, http.StatusOK, dto.RecoveryCodes{RecoveryCodes: recoveryCodes}, nil)
+}
+
+// challengedUser returns the user challenge was issued to and their TOTP
+// secret, zero when they have none. It writes the response unless ok.
+func challengedUser(w http.ResponseWriter, repository database.FilmbaseRepository, encoder json.Encoder, log *slog.Logger, challenge string) (user database.User, totp database.TOTP, ok bool) {
+	username, err := auth.ParseMFAChallenge(challenge)
+	if err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid challenge: %s", err))
+		returnResponse(w, encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return user, totp, false
+	}
+	// The user may have been disabled or deleted since the password was verified.
+	user, err = repository.UserCredentials(username)
+	if err == nil {
+		totp, err = repository.TOTP(username)
+	}
+	switch {
+	case errors.Is(err, database.ErrUserNotFound):
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return user, totp, false
+	case err != nil && !errors.Is(err, database.ErrMFANotEnrolled):
+		returnError(w, encoder, log, err)
+		return user, totp, false
+	}
+	return user, totp, true
+}
+
+// currentTOTP decodes the one-time password in the body and returns it with
+// the TOTP secret of the current user. It writes the response unless ok.
+func currentTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, encoder json.Encoder, log *slog.Logger) (code string, totp database.TOTP, ok bool) {
+	username, ok := currentUser(w, r, encoder, log)
+	if !ok {
+		return "", totp, false
+	}
+	var request dto.OTP
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return "", totp, false
+	}
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return "", totp, false
+	}
+	totp, err := repository.TOTP(username)
+	if errors.Is(err, database.ErrMFANotEnrolled) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return "", totp, false
+	}
+	if err != nil {
+		returnError(w, encoder, log, err)
+		return "", totp, false
+	}
+	return request.Code, totp, true
+}
+
+// beginTOTP stores a new unconfirmed secret for username and responds with it.
+func beginTOTP(w http.ResponseWriter, repository database.FilmbaseRepository, encoder json.Encoder, log *slog.Logger, username string) {
+	secret, err := auth.NewTOTPSecret()
+	if err == nil {
+		err = repository.BeginTOTP(username, secret)
+	}
+	if err != nil {
+		returnError(w, encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("TOTP enrollment of %s begun", username))
+	returnResponse(w, encoder, http.StatusCreated, dto.TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(auth.Settings().Issuer, username, secret),
+	}, nil)
+}
+
+// confirmTOTP confirms the unconfirmed totp if code is one of its codes, and
+// returns the recovery codes issued with it.
+func confirmTOTP(repository database.FilmbaseRepository, totp database.TOTP, code string) ([]string, bool, error) {
+	step, ok, err := auth.VerifyTOTP(totp.Secret, code, time.Now(), totp.LastStep)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	recoveryCodes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+	err = repository.ConfirmTOTP(totp.Username, step, hashes)
+	if errors.Is(err, database.ErrOTPInvalid) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return recoveryCodes, true, nil
+}
+
+// verifySecondFactor reports whether code is a code of the confirmed totp not
+// presented before, or with allowRecovery, a recovery code of its user. Either
+// is spent.
+func verifySecondFactor(repository database.FilmbaseRepository, totp database.TOTP, code string, allowRecovery bool) (bool, error) {
+	step, ok, err := auth.VerifyTOTP(totp.Secret, code, time.Now(), totp.LastStep)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		err = repository.UseTOTPStep(totp.Username, step)
+	} else if allowRecovery {
+		err = repository.UseRecoveryCode(totp.Username, auth.HashRecoveryCode(code))
+	} else {
+		return false, nil
+	}
+	if errors.Is(err, database.ErrOTPInvalid) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -1,40 +1,67 @@
 package server
 
 import (
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Paincake/filmbase/internal/auth"
 	"github.com/Paincake/filmbase/internal/database"
 	"github.com/Paincake/filmbase/internal/dto"
-	"golang.org/x/crypto/bcrypt"
-	"gopkg.in/validator.v2"
+	"github.com/Paincake/filmbase/internal/lockout"
+	"github.com/Paincake/filmbase/internal/middleware"
+	"github.com/Paincake/filmbase/internal/policy"
+	"github.com/Paincake/filmbase/internal/problem"
+	"github.com/google/uuid"
+	"io"
 	"log/slog"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	Filmbase_authScopes = "filmbase_auth.Scopes"
+	Filmbase_authScopes = policy.ScopesContextKey
 	DefaultFilmSortKey  = "DESC"
 	DefaultFilmSortBy   = "rating"
+
+	StatusUp   = "up"
+	StatusDown = "down"
 )
 
 type Response struct {
 	Code         int
-	Error        error
 	ResponseBody any
 }
 
+// returnResponse answers with body, or with err as problem details when err
+// is not nil.
 func returnResponse(w http.ResponseWriter, encoder json.Encoder, code int, body any, err error) {
+	if err != nil {
+		problem.Write(w, code, err)
+		return
+	}
 	w.WriteHeader(code)
 	encoder.Encode(Response{
 		Code:         code,
-		Error:        err,
 		ResponseBody: body,
 	})
 }
 
+// returnError answers with err, with the status of its kind when it is a
+// domain error and 500 otherwise.
+func returnError(w http.ResponseWriter, encoder json.Encoder, log *slog.Logger, err error) {
+	status := problem.Status(err)
+	if status == http.StatusInternalServerError {
+		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
+	} else {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+	}
+	returnResponse(w, encoder, status, nil, err)
+}
+
 // GetFilmParamsSortBy defines parameters for GetFilm.
 type GetFilmParamsSortBy string
 
@@ -103,36 +130,121 @@ type ServerInterface interface {
 	// (POST /login)
 	Login(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
 	Signup(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// RefreshToken Exchange a refresh token for new tokens
+	// (POST /token/refresh)
+	RefreshToken(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// Logout Revoke the access token of the request and the refresh token in the body
+	// (POST /logout)
+	Logout(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// RevokeUserTokens Revoke every token issued to a user
+	// (POST /admin/users/{username}/revoke)
+	RevokeUserTokens(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// UnlockUser Forget the failed logins of a user, lifting their lockout
+	// (POST /admin/users/{username}/unlock)
+	UnlockUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// ListUsers List every user
+	// (GET /admin/users)
+	ListUsers(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// SetUserRole Change the role of a user
+	// (PUT /admin/users/{username}/role)
+	SetUserRole(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// DisableUser Disable a user and revoke their tokens
+	// (POST /admin/users/{username}/disable)
+	DisableUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// EnableUser Enable a disabled user
+	// (POST /admin/users/{username}/enable)
+	EnableUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// DeleteUser Delete a user
+	// (DELETE /admin/users/{username})
+	DeleteUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger)
+	// CreateAPIKey Create an API key for a service account
+	// (POST /admin/api-keys)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// ListAPIKeys List every API key
+	// (GET /admin/api-keys)
+	ListAPIKeys(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// DeleteAPIKey Delete an API key
+	// (DELETE /admin/api-keys/{prefix})
+	DeleteAPIKey(w http.ResponseWriter, r *http.Request, prefix string, repository database.FilmbaseRepository, log *slog.Logger)
+	// ForgotPassword Mail a password reset link to the user with an email
+	// (POST /password/forgot)
+	ForgotPassword(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// ResetPassword Set a new password with a mailed reset token
+	// (POST /password/reset)
+	ResetPassword(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// RequestEmailVerification Mail a verification link to an unverified email
+	// (POST /email/verify/request)
+	RequestEmailVerification(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// VerifyEmail Verify an email with a mailed token
+	// (POST /email/verify)
+	VerifyEmail(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// LoginMFA Complete a login with a one-time password or a recovery code
+	// (POST /login/mfa)
+	LoginMFA(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// EnrollLoginTOTP Enroll a TOTP secret during a login that requires one
+	// (POST /login/mfa/enroll)
+	EnrollLoginTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// BeginTOTP Enroll a TOTP secret, confirmed with its first code
+	// (POST /mfa/totp)
+	BeginTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// ConfirmTOTP Confirm a TOTP secret and get recovery codes
+	// (POST /mfa/totp/confirm)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// DeleteTOTP Stop logging in with a one-time password
+	// (DELETE /mfa/totp)
+	DeleteTOTP(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// RegenerateRecoveryCodes Replace the recovery codes
+	// (POST /mfa/recovery-codes)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// JWKS Publish the public keys access tokens are signed with
+	// (GET /.well-known/jwks.json)
+	JWKS(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// Healthz Report that the process is alive
+	// (GET /healthz)
+	Healthz(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
+	// Readyz Report whether the service dependencies are ready
+	// (GET /readyz)
+	Readyz(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger)
 }
 
 // BasicServer server implementation that returns http.StatusNotImplemented for each endpoint.
-type BasicServer struct{}
+type BasicServer struct {
+	// DefaultRole is the role of signed up users.
+	DefaultRole string
+	// Roles are the roles users may be given, any role when empty.
+	Roles []string
+	// Lockout slows down password guessing on login, nil allows every attempt.
+	Lockout *lockout.Guard
+	// Passwords are the rules passwords of signed up users must follow, nil
+	// accepts any.
+	Passwords *auth.PasswordPolicy
+	// AccountMail makes the mail sent to reset passwords and to verify emails,
+	// nil disables both.
+	AccountMail *AccountMail
+	// MFARoles are the roles that must log in with a one-time password. Users
+	// of other roles only do once they enrolled a TOTP secret.
+	MFARoles []string
+}
 
 // CreateActor Create an actor information
 // (POST /actor)
 func (_ BasicServer) CreateActor(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.CreateActor POST /actor"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
-	role := r.Context().Value("role")
 	encoder := json.NewEncoder(w)
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("you can't access that resource"))
-		return
-	}
 	decoder := json.NewDecoder(r.Body)
 	var actor dto.Actor
 	err := decoder.Decode(&actor)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	err = validator.Validate(actor)
+	err = dto.Validate(actor)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
 
@@ -140,12 +252,11 @@ func (_ BasicServer) CreateActor(w http.ResponseWriter, r *http.Request, reposit
 		Id:        actor.Id,
 		Name:      actor.Name,
 		Gender:    actor.Gender,
-		Birthdate: actor.Birthdate,
+		Birthdate: actor.Birthdate.Time,
 	}
 	id, err := repository.PostActor(entityActor)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, id, nil)
@@ -155,27 +266,21 @@ func (_ BasicServer) CreateActor(w http.ResponseWriter, r *http.Request, reposit
 // (PUT /actor)
 func (_ BasicServer) PutActor(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.PutActor PUT /actor"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	decoder := json.NewDecoder(r.Body)
 	var actor dto.Actor
 	err := decoder.Decode(&actor)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	err = validator.Validate(actor)
+	err = dto.Validate(actor)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
 
@@ -183,12 +288,11 @@ func (_ BasicServer) PutActor(w http.ResponseWriter, r *http.Request, repository
 		Id:        actor.Id,
 		Name:      actor.Name,
 		Gender:    actor.Gender,
-		Birthdate: actor.Birthdate,
+		Birthdate: actor.Birthdate.Time,
 	}
 	err = repository.PutActor(entityActor)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, nil, nil)
@@ -199,18 +303,12 @@ func (_ BasicServer) PutActor(w http.ResponseWriter, r *http.Request, repository
 // (GET /actor/films)
 func (_ BasicServer) GetActorFilms(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.GetActorFilms GET /actor/films"
-	log.With(op)
+	log = log.With("op", op)
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "user" && role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	films, err := repository.GetActorFilms()
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
+		return
 	}
 	actorFilmMap := make(map[dto.Actor][]dto.Film)
 	for _, e := range films {
@@ -218,13 +316,13 @@ func (_ BasicServer) GetActorFilms(w http.ResponseWriter, r *http.Request, repos
 			Id:        e.ActorId,
 			Name:      e.ActorName,
 			Gender:    e.ActorGender,
-			Birthdate: e.ActorBirthdate,
+			Birthdate: dto.NewDate(e.ActorBirthdate),
 		}
 		film := dto.Film{
 			Id:          e.FilmId,
 			Name:        e.FilmName,
 			Description: strings.TrimSuffix(e.FilmDescription, " "),
-			ReleaseDate: e.FilmReleaseDate,
+			ReleaseDate: dto.NewDate(e.FilmReleaseDate),
 			Rating:      e.FilmRating,
 		}
 		if _, ok := actorFilmMap[actor]; ok {
@@ -247,18 +345,11 @@ func (_ BasicServer) GetActorFilms(w http.ResponseWriter, r *http.Request, repos
 // (DELETE /actor/{actorId})
 func (_ BasicServer) DeleteActor(w http.ResponseWriter, r *http.Request, actorId int64, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.DeleteActor DELETE /actor"
-	log.With(op)
+	log = log.With("op", op)
 	encoder := json.NewEncoder(w)
 	err := repository.DeleteActorById(actorId)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, nil, nil)
@@ -268,18 +359,11 @@ func (_ BasicServer) DeleteActor(w http.ResponseWriter, r *http.Request, actorId
 // (POST /actor/{actorId}/{filmId})
 func (_ BasicServer) PostActorFilm(w http.ResponseWriter, r *http.Request, actorId int64, filmId int64, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.PostActorFilm POST /actor"
-	log.With(op)
+	log = log.With("op", op)
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	err := repository.PostActorFilm(actorId, filmId)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, nil, nil)
@@ -289,15 +373,9 @@ func (_ BasicServer) PostActorFilm(w http.ResponseWriter, r *http.Request, actor
 // (GET /film)
 func (_ BasicServer) GetFilm(w http.ResponseWriter, r *http.Request, params GetFilmParams, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.GetFilm GET /film"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" && role != "user" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	var sortBy, sortKey string
 	if string(*params.SortBy) == "" {
 		sortBy = DefaultFilmSortBy
@@ -311,8 +389,7 @@ func (_ BasicServer) GetFilm(w http.ResponseWriter, r *http.Request, params GetF
 	}
 	films, err := repository.GetFilm(sortBy, sortKey)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, films, nil)
@@ -323,40 +400,33 @@ func (_ BasicServer) GetFilm(w http.ResponseWriter, r *http.Request, params GetF
 // (POST /film)
 func (_ BasicServer) CreateFilm(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.CreateFilm POST /film"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	decoder := json.NewDecoder(r.Body)
 	var film dto.Film
 	err := decoder.Decode(&film)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	err = validator.Validate(film)
+	err = dto.Validate(film)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
 	entityFilm := database.Film{
 		Id:          film.Id,
 		Name:        film.Name,
 		Description: film.Description,
-		ReleaseDate: film.ReleaseDate,
+		ReleaseDate: film.ReleaseDate.Time,
 		Rating:      film.Rating,
 	}
 	id, err := repository.PostFilm(entityFilm)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, id, nil)
@@ -366,40 +436,33 @@ func (_ BasicServer) CreateFilm(w http.ResponseWriter, r *http.Request, reposito
 // (PUT /film)
 func (_ BasicServer) ChangeFilm(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.ChangeFilm PUT /film"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	decoder := json.NewDecoder(r.Body)
 	var film dto.Film
 	err := decoder.Decode(&film)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	err = validator.Validate(film)
+	err = dto.Validate(film)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
 	entityFilm := database.Film{
 		Id:          film.Id,
 		Name:        film.Name,
 		Description: film.Description,
-		ReleaseDate: film.ReleaseDate,
+		ReleaseDate: film.ReleaseDate.Time,
 		Rating:      film.Rating,
 	}
 	err = repository.PutFilm(entityFilm)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, nil, nil)
@@ -409,15 +472,9 @@ func (_ BasicServer) ChangeFilm(w http.ResponseWriter, r *http.Request, reposito
 // (GET /film/search)
 func (_ BasicServer) GetFilmSearch(w http.ResponseWriter, r *http.Request, params GetFilmSearchParams, repository database.FilmbaseRepository, log *slog.Logger) {
 	const op = "server.GetFilmSearch GET /film/search"
-	log.With(op)
+	log = log.With("op", op)
 	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" && role != "user" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	var sortBy, sortKey string
 	if string(*params.SortBy) == "" {
 		sortBy = DefaultFilmSortBy
@@ -431,8 +488,7 @@ func (_ BasicServer) GetFilmSearch(w http.ResponseWriter, r *http.Request, param
 	}
 	films, err := repository.GetFilmSearch(params.FilmName, params.ActorName, sortBy, sortKey)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, films, nil)
@@ -441,80 +497,430 @@ func (_ BasicServer) GetFilmSearch(w http.ResponseWriter, r *http.Request, param
 // DeleteFilm Delete film information
 // (DELETE /film/{filmId})
 func (_ BasicServer) DeleteFilm(w http.ResponseWriter, r *http.Request, filmId int64, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.DeleteFilm DELETE /film"
+	log = log.With("op", op)
 	encoder := json.NewEncoder(w)
-	role := r.Context().Value("role")
-	if role != "admin" {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
-		return
-	}
 	err := repository.DeleteFilmById(filmId)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
 	returnResponse(w, *encoder, http.StatusOK, nil, nil)
 
 }
 
-func (_ BasicServer) Login(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+func (s BasicServer) Login(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.Login POST /login"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
 	encoder := json.NewEncoder(w)
-	creds := r.Header.Get("Authorization")
-	if creds == "" || len(strings.Split(creds, " ")) < 2 {
-		returnResponse(w, *encoder, http.StatusUnauthorized, nil, nil)
+	creds, err := loginCredentials(r)
+	if err != nil {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		w.Header().Set("WWW-Authenticate", basicChallenge)
+		returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return
+	}
+	clientIP := middleware.ClientIP(r)
+	if s.loginThrottled(w, *encoder, repository, log, creds.Username, clientIP) {
 		return
 	}
-	creds = strings.Split(creds, " ")[1]
-	raw, err := base64.StdEncoding.DecodeString(creds)
+	user, ok, err := verifyCredentials(repository, log, creds)
 	if err != nil {
-		returnResponse(w, *encoder, http.StatusUnauthorized, err, nil)
+		returnError(w, *encoder, log, err)
 		return
 	}
-	decodedCreds := strings.Split(string(raw), ":")
-	role, err := repository.Login(decodedCreds[0], decodedCreds[1])
+	if !ok {
+		log.Info(fmt.Sprintf("Request discarded: login of %s failed: invalid credentials", creds.Username))
+		s.loginFailed(repository, log, creds.Username, clientIP, "invalid credentials")
+		w.Header().Set("WWW-Authenticate", basicChallenge)
+		returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return
+	}
+	// Failed logins are only forgotten once the second factor is presented too.
+	challenge, err := s.mfaChallenge(repository, user)
 	if err != nil {
-		returnResponse(w, *encoder, http.StatusUnauthorized, err, nil)
+		returnError(w, *encoder, log, err)
 		return
 	}
-	token, err := auth.CreateJWT(decodedCreds[0], role)
+	if challenge != nil {
+		s.loginPassed(log, user.Username, clientIP)
+		log.Info(fmt.Sprintf("Login of %s awaits a one-time password", user.Username))
+		returnResponse(w, *encoder, http.StatusAccepted, challenge, nil)
+		return
+	}
+	s.loginSucceeded(log, user.Username, clientIP)
+	token, err := issueTokens(repository, user.Username, user.Role, uuid.NewString())
 	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	returnResponse(w, *encoder, http.StatusOK, token, nil)
+}
 
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
+// loginThrottled counts the login of username from clientIP towards their
+// lockout until it succeeds and reports whether it is throttled, in which case
+// the response is written.
+func (s BasicServer) loginThrottled(w http.ResponseWriter, encoder json.Encoder, repository database.FilmbaseRepository, log *slog.Logger, username, clientIP string) bool {
+	if s.Lockout == nil {
+		return false
+	}
+	wait, err := s.Lockout.Attempt(username, clientIP)
+	if err != nil {
+		returnError(w, encoder, log, err)
+		return true
+	}
+	// The credentials are not even checked, so that guessing them right does not help.
+	if wait > 0 {
+		log.Info(fmt.Sprintf("Request discarded: login of %s from %s throttled for %s", username, clientIP, wait))
+		auditFailedLogin(repository, log, username, clientIP, "throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		returnResponse(w, encoder, http.StatusTooManyRequests, nil, fmt.Errorf("too many failed logins"))
+		return true
+	}
+	return false
+}
+
+// loginFailed audits a failed login of username. loginThrottled counted it
+// towards their lockout already.
+func (s BasicServer) loginFailed(repository database.FilmbaseRepository, log *slog.Logger, username, clientIP, reason string) {
+	auditFailedLogin(repository, log, username, clientIP, reason)
+}
+
+// loginPassed takes back the login of username from clientIP counted by
+// loginThrottled, as their password was valid, while their failed logins are
+// kept until the second factor is presented.
+func (s BasicServer) loginPassed(log *slog.Logger, username, clientIP string) {
+	if s.Lockout != nil {
+		if err := s.Lockout.Forgive(username, clientIP); err != nil {
+			log.Error(fmt.Sprintf("Taking back the login of %s: %s", username, err))
+		}
+	}
+}
 
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+// loginSucceeded forgets the failed logins of username and takes back the
+// login from clientIP counted by loginThrottled.
+func (s BasicServer) loginSucceeded(log *slog.Logger, username, clientIP string) {
+	if s.Lockout != nil {
+		if err := s.Lockout.Succeed(username, clientIP); err != nil {
+			log.Error(fmt.Sprintf("Resetting failed logins of %s: %s", username, err))
+		}
+	}
+}
+
+// verifyCredentials returns the user creds belong to and whether they are
+// valid. A password hash made with outdated options is replaced on the way.
+func verifyCredentials(repository database.FilmbaseRepository, log *slog.Logger, creds dto.User) (database.User, bool, error) {
+	user, err := repository.UserCredentials(creds.Username)
+	if errors.Is(err, database.ErrUserNotFound) {
+		auth.VerifyNoPassword(creds.Password)
+		return user, false, nil
+	}
+	if err != nil {
+		return user, false, err
+	}
+	ok, rehash, err := auth.VerifyPassword(user.Password, creds.Password)
+	if err != nil || !ok {
+		return user, false, err
+	}
+	if rehash {
+		hash, err := auth.HashPassword(creds.Password)
+		if err == nil {
+			err = repository.SetUserPassword(user.Username, hash)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("Rehashing password of %s: %s", user.Username, err))
+		} else {
+			log.Info(fmt.Sprintf("Password of %s rehashed", user.Username))
+		}
+	}
+	return user, true, nil
+}
+
+// auditFailedLogin keeps a record of a failed login of username. Failing to
+// keep it does not fail the request.
+func auditFailedLogin(repository database.FilmbaseRepository, log *slog.Logger, username, clientIP, reason string) {
+	err := repository.AuditFailedLogin(database.FailedLogin{Username: username, ClientIP: clientIP, Reason: reason, At: time.Now()})
+	if err != nil {
+		log.Error(fmt.Sprintf("Auditing failed login of %s: %s", username, err))
+	}
+}
+
+// basicChallenge is the WWW-Authenticate header of failed logins (RFC 7617).
+var basicChallenge = fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", middleware.Realm)
+
+// loginCredentials returns the credentials of a login, a JSON body or Basic
+// credentials in the Authorization header.
+func loginCredentials(r *http.Request) (dto.User, error) {
+	var creds dto.User
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+			return creds, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		if err := dto.Validate(creds); err != nil {
+			return creds, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return creds, nil
+	}
+	// BasicAuth splits at the first colon, passwords may contain colons.
+	username, password, ok := r.BasicAuth()
+	if !ok || username == "" {
+		return creds, errors.New("credentials absent or malformed")
+	}
+	return dto.User{Username: username, Password: password}, nil
+}
+
+// RefreshToken Exchange a refresh token for new tokens
+// (POST /token/refresh)
+func (_ BasicServer) RefreshToken(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.RefreshToken POST /token/refresh"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	var request dto.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	returnResponse(w, *encoder, http.StatusOK, token, nil)
+	if err := dto.Validate(request); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	user, err := repository.RotateRefreshToken(auth.HashToken(request.RefreshToken), database.RefreshToken{
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(auth.Settings().RefreshTTL),
+	})
+	switch {
+	case errors.Is(err, database.ErrTokenReused):
+		log.Warn("Request discarded: refresh token reused, token family revoked")
+		returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return
+	case errors.Is(err, database.ErrTokenNotFound), errors.Is(err, database.ErrTokenExpired), errors.Is(err, database.ErrUserNotFound):
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusUnauthorized, nil, fmt.Errorf("unauthorized"))
+		return
+	case err != nil:
+		returnError(w, *encoder, log, err)
+		return
+	}
+	middleware.LogWith(r.Context(), "user", user.Username, "role", user.Role)
+	accessToken, err := auth.CreateJWT(user.Username, user.Role)
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	returnResponse(w, *encoder, http.StatusOK, newToken(accessToken, refreshToken), nil)
+}
 
+// currentUser returns the user making the request. Requests authenticated by
+// an API key are forbidden, as a key is no user whose tokens or second factor
+// could be managed. It writes the response unless ok.
+func currentUser(w http.ResponseWriter, r *http.Request, encoder json.Encoder, log *slog.Logger) (username string, ok bool) {
+	if middleware.AuthMethod(r.Context()) == middleware.MethodAPIKey {
+		log.Info("Request discarded: an API key is not a user")
+		returnResponse(w, encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
+		return "", false
+	}
+	username, _ = r.Context().Value("username").(string)
+	return username, true
 }
-func (_ BasicServer) Signup(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+
+// Logout Revoke the access token of the request and the refresh token in the body
+// (POST /logout)
+func (_ BasicServer) Logout(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.Logout POST /logout"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	username, ok := currentUser(w, r, *encoder, log)
+	if !ok {
+		return
+	}
+	var request dto.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if jti, ok := r.Context().Value("jti").(string); ok {
+		expiresAt, _ := r.Context().Value("exp").(time.Time)
+		if err := repository.RevokeToken(jti, expiresAt); err != nil {
+			returnError(w, *encoder, log, err)
+			return
+		}
+	}
+	if request.RefreshToken != "" {
+		if err := repository.RevokeRefreshToken(auth.HashToken(request.RefreshToken), username); err != nil {
+			returnError(w, *encoder, log, err)
+			return
+		}
+	}
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+// RevokeUserTokens Revoke every token issued to a user
+// (POST /admin/users/{username}/revoke)
+func (_ BasicServer) RevokeUserTokens(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.RevokeUserTokens POST /admin/users/{username}/revoke"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	err := repository.RevokeUserTokens(username)
+	if errors.Is(err, database.ErrUserNotFound) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("Revoked every token of %s", username))
+	returnResponse(w, *encoder, http.StatusOK, nil, nil)
+}
+
+// issueTokens issues an access token and a refresh token in family for username.
+func issueTokens(repository database.FilmbaseRepository, username, role, family string) (dto.Token, error) {
+	accessToken, err := auth.CreateJWT(username, role)
+	if err != nil {
+		return dto.Token{}, err
+	}
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return dto.Token{}, err
+	}
+	err = repository.CreateRefreshToken(database.RefreshToken{
+		Hash:      hash,
+		Family:    family,
+		Username:  username,
+		ExpiresAt: time.Now().Add(auth.Settings().RefreshTTL),
+	})
+	if err != nil {
+		return dto.Token{}, err
+	}
+	return newToken(accessToken, refreshToken), nil
+}
+
+func newToken(accessToken, refreshToken string) dto.Token {
+	return dto.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.Settings().AccessTTL.Seconds()),
+	}
+}
+func (s BasicServer) Signup(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.Signup POST /sign"
+	log = log.With("op", op)
 	encoder := json.NewEncoder(w)
 	decoder := json.NewDecoder(r.Body)
 	var user dto.User
 	err := decoder.Decode(&user)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
 	}
-	err = validator.Validate(user)
+	err = dto.Validate(user)
 	if err != nil {
 		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
-		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
 		return
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 8)
+	if user.Email != "" {
+		if user.Email, err = normalizeEmail(user.Email); err != nil {
+			log.Info(fmt.Sprintf("Request discarded: %s", err))
+			returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+			return
+		}
+	}
+	if s.Passwords != nil {
+		if problems := s.Passwords.Check(user.Username, user.Password); len(problems) > 0 {
+			log.Info(fmt.Sprintf("Request discarded: weak password: %s", strings.Join(problems, ", ")))
+			returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: password %s", strings.Join(problems, ", ")))
+			return
+		}
+	}
+	hashedPassword, err := auth.HashPassword(user.Password)
 	if err != nil {
-		log.Error(fmt.Sprintf("Request discarded: server error: %s", err))
-		returnResponse(w, *encoder, http.StatusInternalServerError, nil, fmt.Errorf("internal server error: %s", err))
+		returnError(w, *encoder, log, err)
 		return
 	}
-	err = repository.Signup(user.Username, string(hashedPassword))
+	err = repository.Signup(user.Username, hashedPassword, s.DefaultRole, user.Email)
 	if err != nil {
-		log.Info(fmt.Sprintf("Request discarded: forbidden"))
-		returnResponse(w, *encoder, http.StatusForbidden, nil, fmt.Errorf("forbidden"))
+		returnError(w, *encoder, log, err)
 		return
 	}
+	if s.AccountMail != nil && user.Email != "" {
+		// The user may ask for the verification to be mailed again.
+		if err = s.AccountMail.mailVerification(repository, user.Username, user.Email); err != nil {
+			log.Error(fmt.Sprintf("Mailing email verification to %s: %s", user.Username, err))
+		}
+	}
 	returnResponse(w, *encoder, http.StatusCreated, nil, nil)
 
 }
+
+// JWKS Publish the public keys access tokens are signed with
+// (GET /.well-known/jwks.json)
+func (_ BasicServer) JWKS(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(auth.JWKS())
+}
+
+// Healthz Report that the process is alive
+// (GET /healthz)
+func (_ BasicServer) Healthz(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto.Health{Status: StatusUp})
+}
+
+// Readyz Report whether the service dependencies are ready
+// (GET /readyz)
+func (_ BasicServer) Readyz(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	health := dto.Health{Status: StatusUp, Checks: make(map[string]dto.Check)}
+
+	// Errors are logged rather than shown, the endpoint is not authenticated.
+	if err := repository.Ping(); err != nil {
+		log.Error(fmt.Sprintf("Readiness check database failed: %s", err))
+		health.Checks["database"] = dto.Check{Status: StatusDown, Error: "database unreachable"}
+	} else {
+		health.Checks["database"] = dto.Check{Status: StatusUp}
+	}
+
+	version, expected, err := repository.MigrationVersion()
+	migrations := dto.Check{Status: StatusUp, Version: version, Expected: expected}
+	if err != nil {
+		log.Error(fmt.Sprintf("Readiness check migrations failed: %s", err))
+		migrations.Status = StatusDown
+		migrations.Error = "schema version unknown"
+	} else if version < expected {
+		// A newer schema is fine, instances of the previous release keep
+		// serving while a new release is rolled out.
+		migrations.Status = StatusDown
+		migrations.Error = fmt.Sprintf("schema version %d, expected %d", version, expected)
+	}
+	health.Checks["migrations"] = migrations
+
+	code := http.StatusOK
+	for name, check := range health.Checks {
+		if check.Status != StatusUp {
+			log.Info(fmt.Sprintf("Readiness check %s failed: %s", name, check.Error))
+			health.Status = StatusDown
+			code = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(health)
+}
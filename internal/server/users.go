@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Paincake/filmbase/internal/database"
+	"github.com/Paincake/filmbase/internal/dto"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// ListUsers List every user
+// (GET /admin/users)
+func (_ BasicServer) ListUsers(w http.ResponseWriter, r *http.Request, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.ListUsers GET /admin/users"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	users, err := repository.ListUsers()
+	if err != nil {
+		returnError(w, *encoder, log, err)
+		return
+	}
+	infos := make([]dto.UserInfo, 0, len(users))
+	for _, u := range users {
+		infos = append(infos, dto.UserInfo{
+			Username:      u.Username,
+			Role:          u.Role,
+			Disabled:      u.Disabled,
+			Provider:      u.Provider,
+			Email:         u.Email,
+			EmailVerified: u.EmailVerified,
+		})
+	}
+	returnResponse(w, *encoder, http.StatusOK, infos, nil)
+}
+
+// SetUserRole Change the role of a user
+// (PUT /admin/users/{username}/role)
+func (s BasicServer) SetUserRole(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.SetUserRole PUT /admin/users/{username}/role"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	var role dto.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if err := dto.Validate(role); err != nil {
+		log.Info(fmt.Sprintf("Request discarded: invalid JSON body: %s", err))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: %w", err))
+		return
+	}
+	if len(s.Roles) > 0 && !slices.Contains(s.Roles, role.Role) {
+		log.Info(fmt.Sprintf("Request discarded: unknown role %q", role.Role))
+		returnResponse(w, *encoder, http.StatusUnprocessableEntity, nil, fmt.Errorf("bad request: unknown role %q", role.Role))
+		return
+	}
+	if isCurrentUser(r, username) {
+		log.Info("Request discarded: admins cannot change their own role")
+		returnResponse(w, *encoder, http.StatusConflict, nil, fmt.Errorf("cannot change your own role"))
+		return
+	}
+	// The role is a claim of issued tokens, so they are revoked to apply it at once.
+	updateUser(w, r, username, *encoder, log, func() error {
+		if err := repository.SetUserRole(username, role.Role); err != nil {
+			return err
+		}
+		return repository.RevokeUserTokens(username)
+	})
+}
+
+// DisableUser Disable a user and revoke their tokens
+// (POST /admin/users/{username}/disable)
+func (_ BasicServer) DisableUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.DisableUser POST /admin/users/{username}/disable"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if isCurrentUser(r, username) {
+		log.Info("Request discarded: admins cannot disable themselves")
+		returnResponse(w, *encoder, http.StatusConflict, nil, fmt.Errorf("cannot disable yourself"))
+		return
+	}
+	updateUser(w, r, username, *encoder, log, func() error {
+		if err := repository.SetUserDisabled(username, true); err != nil {
+			return err
+		}
+		return repository.RevokeUserTokens(username)
+	})
+}
+
+// EnableUser Enable a disabled user
+// (POST /admin/users/{username}/enable)
+func (_ BasicServer) EnableUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.EnableUser POST /admin/users/{username}/enable"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	updateUser(w, r, username, *json.NewEncoder(w), log, func() error {
+		return repository.SetUserDisabled(username, false)
+	})
+}
+
+// UnlockUser Forget the failed logins of a user, lifting their lockout
+// (POST /admin/users/{username}/unlock)
+func (s BasicServer) UnlockUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.UnlockUser POST /admin/users/{username}/unlock"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if s.Lockout == nil {
+		log.Info("Request discarded: lockout disabled")
+		returnResponse(w, *encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	updateUser(w, r, username, *encoder, log, func() error {
+		return s.Lockout.Unlock(username)
+	})
+}
+
+// DeleteUser Delete a user
+// (DELETE /admin/users/{username})
+func (_ BasicServer) DeleteUser(w http.ResponseWriter, r *http.Request, username string, repository database.FilmbaseRepository, log *slog.Logger) {
+	const op = "server.DeleteUser DELETE /admin/users/{username}"
+	log = log.With("op", op)
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if isCurrentUser(r, username) {
+		log.Info("Request discarded: admins cannot delete themselves")
+		returnResponse(w, *encoder, http.StatusConflict, nil, fmt.Errorf("cannot delete yourself"))
+		return
+	}
+	updateUser(w, r, username, *encoder, log, func() error {
+		return repository.DeleteUser(username)
+	})
+}
+
+// isCurrentUser reports whether username is the user making the request, who
+// would lock themselves out.
+func isCurrentUser(r *http.Request, username string) bool {
+	current, _ := r.Context().Value("username").(string)
+	return current == username
+}
+
+// updateUser runs update of username and responds with its outcome.
+func updateUser(w http.ResponseWriter, r *http.Request, username string, encoder json.Encoder, log *slog.Logger, update func() error) {
+	err := update()
+	if errors.Is(err, database.ErrUserNotFound) {
+		log.Info(fmt.Sprintf("Request discarded: %s", err))
+		returnResponse(w, encoder, http.StatusNotFound, nil, fmt.Errorf("not found"))
+		return
+	}
+	if err != nil {
+		returnError(w, encoder, log, err)
+		return
+	}
+	log.Info(fmt.Sprintf("User %s updated by %v", username, r.Context().Value("username")))
+	returnResponse(w, encoder, http.StatusOK, nil, nil)
+}
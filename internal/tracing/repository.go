@@ -0,0 +1,367 @@
+package tracing
+
+import (
+	"context"
+	"github.com/Paincake/filmbase/internal/database"
+	"time"
+)
+
+// Repository starts a child span of the request span for every call to the
+// wrapped database.FilmbaseRepository. It is created per request, as the
+// repository methods do not take a context.
+type Repository struct {
+	database.FilmbaseRepository
+	ctx context.Context
+}
+
+func NewRepository(ctx context.Context, repository database.FilmbaseRepository) *Repository {
+	return &Repository{FilmbaseRepository: repository, ctx: ctx}
+}
+
+func (t *Repository) Ping() (err error) {
+	_, span := startQuerySpan(t.ctx, "Ping")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.Ping()
+}
+
+func (t *Repository) MigrationVersion() (version int, expected int, err error) {
+	_, span := startQuerySpan(t.ctx, "MigrationVersion")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.MigrationVersion()
+}
+
+func (t *Repository) PostActor(actor database.Actor) (id int64, err error) {
+	_, span := startQuerySpan(t.ctx, "PostActor")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PostActor(actor)
+}
+
+func (t *Repository) PutActor(actor database.Actor) (err error) {
+	_, span := startQuerySpan(t.ctx, "PutActor")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PutActor(actor)
+}
+
+func (t *Repository) DeleteActorById(actorId int64) (err error) {
+	_, span := startQuerySpan(t.ctx, "DeleteActorById")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.DeleteActorById(actorId)
+}
+
+func (t *Repository) GetActorFilms() (films []database.ActorFilm, err error) {
+	_, span := startQuerySpan(t.ctx, "GetActorFilms")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.GetActorFilms()
+}
+
+func (t *Repository) PostActorFilm(actorId, filmId int64) (err error) {
+	_, span := startQuerySpan(t.ctx, "PostActorFilm")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PostActorFilm(actorId, filmId)
+}
+
+func (t *Repository) GetFilmSearch(filmName string, actorName string, sortBy string, sortKey string) (films []database.ActorFilm, err error) {
+	_, span := startQuerySpan(t.ctx, "GetFilmSearch")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.GetFilmSearch(filmName, actorName, sortBy, sortKey)
+}
+
+func (t *Repository) GetFilm(sortBy string, sortKey string) (films []database.Film, err error) {
+	_, span := startQuerySpan(t.ctx, "GetFilm")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.GetFilm(sortBy, sortKey)
+}
+
+func (t *Repository) PostFilm(film database.Film) (id int64, err error) {
+	_, span := startQuerySpan(t.ctx, "PostFilm")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PostFilm(film)
+}
+
+func (t *Repository) PutFilm(film database.Film) (err error) {
+	_, span := startQuerySpan(t.ctx, "PutFilm")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PutFilm(film)
+}
+
+func (t *Repository) DeleteFilmById(filmId int64) (err error) {
+	_, span := startQuerySpan(t.ctx, "DeleteFilmById")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.DeleteFilmById(filmId)
+}
+
+func (t *Repository) UserCredentials(username string) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "UserCredentials")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UserCredentials(username)
+}
+
+func (t *Repository) SetUserPassword(username string, hash string) (err error) {
+	_, span := startQuerySpan(t.ctx, "SetUserPassword")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.SetUserPassword(username, hash)
+}
+
+func (t *Repository) Signup(username string, password string, role string, email string) (err error) {
+	_, span := startQuerySpan(t.ctx, "Signup")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.Signup(username, password, role, email)
+}
+
+func (t *Repository) ListUsers() (users []database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "ListUsers")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ListUsers()
+}
+
+func (t *Repository) SetUserRole(username string, role string) (err error) {
+	_, span := startQuerySpan(t.ctx, "SetUserRole")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.SetUserRole(username, role)
+}
+
+func (t *Repository) SetUserDisabled(username string, disabled bool) (err error) {
+	_, span := startQuerySpan(t.ctx, "SetUserDisabled")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.SetUserDisabled(username, disabled)
+}
+
+func (t *Repository) DeleteUser(username string) (err error) {
+	_, span := startQuerySpan(t.ctx, "DeleteUser")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.DeleteUser(username)
+}
+
+func (t *Repository) CreateRefreshToken(token database.RefreshToken) (err error) {
+	_, span := startQuerySpan(t.ctx, "CreateRefreshToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.CreateRefreshToken(token)
+}
+
+func (t *Repository) RotateRefreshToken(hash string, next database.RefreshToken) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "RotateRefreshToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RotateRefreshToken(hash, next)
+}
+
+func (t *Repository) RevokeRefreshToken(hash string, username string) (err error) {
+	_, span := startQuerySpan(t.ctx, "RevokeRefreshToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RevokeRefreshToken(hash, username)
+}
+
+func (t *Repository) RevokeToken(jti string, expiresAt time.Time) (err error) {
+	_, span := startQuerySpan(t.ctx, "RevokeToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RevokeToken(jti, expiresAt)
+}
+
+func (t *Repository) RevokeUserTokens(username string) (err error) {
+	_, span := startQuerySpan(t.ctx, "RevokeUserTokens")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RevokeUserTokens(username)
+}
+
+func (t *Repository) IsTokenRevoked(jti string, username string, issuedAt time.Time) (revoked bool, err error) {
+	_, span := startQuerySpan(t.ctx, "IsTokenRevoked")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.IsTokenRevoked(jti, username, issuedAt)
+}
+
+func (t *Repository) PruneTokens() (pruned int64, err error) {
+	_, span := startQuerySpan(t.ctx, "PruneTokens")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PruneTokens()
+}
+
+func (t *Repository) SigningKeys(retiredAfter time.Time) (keys []database.SigningKey, err error) {
+	_, span := startQuerySpan(t.ctx, "SigningKeys")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.SigningKeys(retiredAfter)
+}
+
+func (t *Repository) CreateSigningKey(key database.SigningKey) (err error) {
+	_, span := startQuerySpan(t.ctx, "CreateSigningKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.CreateSigningKey(key)
+}
+
+func (t *Repository) CreateFirstSigningKey(key database.SigningKey) (created bool, err error) {
+	_, span := startQuerySpan(t.ctx, "CreateFirstSigningKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.CreateFirstSigningKey(key)
+}
+
+func (t *Repository) UpdateSigningKey(id string, privateKey []byte) (err error) {
+	_, span := startQuerySpan(t.ctx, "UpdateSigningKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UpdateSigningKey(id, privateKey)
+}
+
+func (t *Repository) RetireSigningKey(id string) (err error) {
+	_, span := startQuerySpan(t.ctx, "RetireSigningKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RetireSigningKey(id)
+}
+
+func (t *Repository) CreateAPIKey(key database.APIKey) (err error) {
+	_, span := startQuerySpan(t.ctx, "CreateAPIKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.CreateAPIKey(key)
+}
+
+func (t *Repository) ListAPIKeys() (keys []database.APIKey, err error) {
+	_, span := startQuerySpan(t.ctx, "ListAPIKeys")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ListAPIKeys()
+}
+
+func (t *Repository) APIKey(prefix string) (key database.APIKey, err error) {
+	_, span := startQuerySpan(t.ctx, "APIKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.APIKey(prefix)
+}
+
+func (t *Repository) TouchAPIKey(prefix string) (err error) {
+	_, span := startQuerySpan(t.ctx, "TouchAPIKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.TouchAPIKey(prefix)
+}
+
+func (t *Repository) DeleteAPIKey(prefix string) (err error) {
+	_, span := startQuerySpan(t.ctx, "DeleteAPIKey")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.DeleteAPIKey(prefix)
+}
+
+func (t *Repository) ProvisionUser(username string, provider string, role string) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "ProvisionUser")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ProvisionUser(username, provider, role)
+}
+
+func (t *Repository) RecordLoginAttempt(key string, at time.Time, since time.Time) (attempts database.LoginAttempts, err error) {
+	_, span := startQuerySpan(t.ctx, "RecordLoginAttempt")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.RecordLoginAttempt(key, at, since)
+}
+
+func (t *Repository) ForgiveLoginAttempt(key string) (err error) {
+	_, span := startQuerySpan(t.ctx, "ForgiveLoginAttempt")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ForgiveLoginAttempt(key)
+}
+
+func (t *Repository) ResetLoginAttempts(key string) (err error) {
+	_, span := startQuerySpan(t.ctx, "ResetLoginAttempts")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ResetLoginAttempts(key)
+}
+
+func (t *Repository) AuditFailedLogin(login database.FailedLogin) (err error) {
+	_, span := startQuerySpan(t.ctx, "AuditFailedLogin")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.AuditFailedLogin(login)
+}
+
+func (t *Repository) PruneLoginAttempts(before time.Time) (pruned int64, err error) {
+	_, span := startQuerySpan(t.ctx, "PruneLoginAttempts")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PruneLoginAttempts(before)
+}
+
+func (t *Repository) UserByEmail(email string) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "UserByEmail")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UserByEmail(email)
+}
+
+func (t *Repository) CreateUserToken(token database.UserToken, mail database.Mail) (err error) {
+	_, span := startQuerySpan(t.ctx, "CreateUserToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.CreateUserToken(token, mail)
+}
+
+func (t *Repository) UserToken(hash string, purpose string) (token database.UserToken, err error) {
+	_, span := startQuerySpan(t.ctx, "UserToken")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UserToken(hash, purpose)
+}
+
+func (t *Repository) ResetPassword(hash string, password string) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "ResetPassword")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ResetPassword(hash, password)
+}
+
+func (t *Repository) VerifyEmail(hash string) (user database.User, err error) {
+	_, span := startQuerySpan(t.ctx, "VerifyEmail")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.VerifyEmail(hash)
+}
+
+func (t *Repository) ClaimMail(limit int, lease time.Duration) (mail []database.Mail, err error) {
+	_, span := startQuerySpan(t.ctx, "ClaimMail")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ClaimMail(limit, lease)
+}
+
+func (t *Repository) MarkMailSent(id int64) (err error) {
+	_, span := startQuerySpan(t.ctx, "MarkMailSent")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.MarkMailSent(id)
+}
+
+func (t *Repository) MarkMailFailed(id int64, reason string, retryAt *time.Time) (err error) {
+	_, span := startQuerySpan(t.ctx, "MarkMailFailed")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.MarkMailFailed(id, reason, retryAt)
+}
+
+func (t *Repository) PruneMail(before time.Time) (pruned int64, err error) {
+	_, span := startQuerySpan(t.ctx, "PruneMail")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.PruneMail(before)
+}
+
+func (t *Repository) TOTP(username string) (totp database.TOTP, err error) {
+	_, span := startQuerySpan(t.ctx, "TOTP")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.TOTP(username)
+}
+
+func (t *Repository) BeginTOTP(username string, secret string) (err error) {
+	_, span := startQuerySpan(t.ctx, "BeginTOTP")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.BeginTOTP(username, secret)
+}
+
+func (t *Repository) ConfirmTOTP(username string, step int64, hashes []string) (err error) {
+	_, span := startQuerySpan(t.ctx, "ConfirmTOTP")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.ConfirmTOTP(username, step, hashes)
+}
+
+func (t *Repository) UseTOTPStep(username string, step int64) (err error) {
+	_, span := startQuerySpan(t.ctx, "UseTOTPStep")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UseTOTPStep(username, step)
+}
+
+func (t *Repository) UseRecoveryCode(username string, hash string) (err error) {
+	_, span := startQuerySpan(t.ctx, "UseRecoveryCode")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.UseRecoveryCode(username, hash)
+}
+
+func (t *Repository) SetRecoveryCodes(username string, hashes []string) (err error) {
+	_, span := startQuerySpan(t.ctx, "SetRecoveryCodes")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.SetRecoveryCodes(username, hashes)
+}
+
+func (t *Repository) DeleteTOTP(username string) (err error) {
+	_, span := startQuerySpan(t.ctx, "DeleteTOTP")
+	defer func() { endSpan(span, err) }()
+	return t.FilmbaseRepository.DeleteTOTP(username)
+}
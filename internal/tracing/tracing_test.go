@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartServerSpan_ShouldContinueTraceparent(t *testing.T) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	req := httptest.NewRequest("GET", "/film", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, span := StartServerSpan(req, "GetFilm")
+	defer span.End()
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	var buf bytes.Buffer
+	Logger(ctx, slog.New(slog.NewJSONHandler(&buf, nil))).Info("test")
+	assert.Contains(t, buf.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+}
+
+func TestLogger_ShouldKeepLoggerWithoutSpan(t *testing.T) {
+	logger := slog.Default()
+	assert.Same(t, logger, Logger(context.Background(), logger))
+}